@@ -0,0 +1,75 @@
+package bmp
+
+import "math"
+
+// Reports whether the option produces transparency
+func IsAlphaOption(name string) bool {
+	return name == "--chroma" || name == "--mask"
+}
+
+// Removes a key color (a green screen by default). The value is "[<key>][,<params>]" with the
+// parameters key, tolerance (chroma distance 0-255 that is fully transparent, default 40), softness
+// (distance over which pixels fade back in, default 40) and spill (0-1, how much of the key color
+// cast is removed from the remaining pixels, default 1). Returns the pixels and their opacity
+func ApplyChromaKey(pixels []Pixel, width, height int, value string) ([]Pixel, Mask, error) {
+	params := parseFilterParams("chroma", value, "key", "tolerance", "softness", "spill")
+	key := params.Color("key", Pixel{Green: 255})
+	tolerance := params.Float("tolerance", 40, 0, 255)
+	softness := params.Float("softness", 40, 0, 255)
+	spill := params.Float("spill", 1, 0, 1)
+	if err := params.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	// Pixels are compared by chroma only, so shadows and highlights on the screen are keyed as well
+	keyChroma := rgbToYCbCr(pixelToRGB(key))
+	keyChannel := dominantChannel(key)
+
+	alpha := make(Mask, len(pixels))
+	for i, p := range pixels {
+		c := rgbToYCbCr(pixelToRGB(p))
+		distance := math.Hypot(c[1]-keyChroma[1], c[2]-keyChroma[2]) * 255
+
+		switch {
+		case distance <= tolerance:
+			alpha[i] = 0
+		case distance >= tolerance+softness:
+			alpha[i] = 1
+		default:
+			alpha[i] = (distance - tolerance) / softness
+		}
+
+		// Limit the key channel to the stronger of the other two channels
+		if spill > 0 {
+			rgb := pixelToRGB(p)
+			limit := math.Max(rgb[(keyChannel+1)%3], rgb[(keyChannel+2)%3])
+			if excess := rgb[keyChannel] - limit; excess > 0 {
+				rgb[keyChannel] -= spill * excess
+				pixels[i] = rgbToPixel(rgb)
+			}
+		}
+	}
+	return pixels, alpha, nil
+}
+
+// Returns the index (in RGB order) of the strongest channel of the color
+func dominantChannel(p Pixel) int {
+	switch {
+	case p.Red >= p.Green && p.Red >= p.Blue:
+		return 0
+	case p.Green >= p.Blue:
+		return 1
+	}
+	return 2
+}
+
+// Combines two opacity masks. A nil mask stands for a fully opaque image
+func MultiplyAlpha(alpha, other Mask) Mask {
+	if alpha == nil {
+		return other
+	}
+	for i := range alpha {
+		alpha[i] *= other[i]
+	}
+	return alpha
+}
@@ -12,7 +12,7 @@ func ParseArgs(args []string) (command string, filename string, outputFilename s
 		return "", "", "", nil, errors.New("invalid number of arguments")
 	}
 
-	command = args[0] // "header" or "apply"
+	command = args[0] // "header", "apply", "compose", "hald" or "cube"
 
 	// Handle "header" command (only requires filename)
 	if command == "header" {
@@ -32,25 +32,139 @@ func ParseArgs(args []string) (command string, filename string, outputFilename s
 		filename = args[len(args)-2]       // Second-to-last argument is the source file
 		outputFilename = args[len(args)-1] // Last argument is the output file
 
-		for i := 1; i < len(args)-2; i++ { // Ignore the last two arguments (file names)
-			if strings.HasPrefix(args[i], "--") {
-				// Break down the option into the option name and its associated value
-				parts := strings.SplitN(args[i], "=", 2)
-				if len(parts) != 2 {
-					return "", "", "", nil, fmt.Errorf("invalid option format: %s", args[i])
-				}
-				name, value := parts[0], parts[1]
+		orderedOptions, err = parseOptions(args[1 : len(args)-2]) // Ignore the last two arguments (file names)
+		if err != nil {
+			return "", "", "", nil, err
+		}
+
+		return command, filename, outputFilename, orderedOptions, nil
+	}
 
-				// Slice of struct preserves the insertion order of the applied options
-				orderedOptions = append(orderedOptions, Option{Name: name, Value: value})
-			} else {
-				return "", "", "", nil, fmt.Errorf("unexpected argument: %s", args[i])
-			}
+	// Handle "compose" command (requires the --layer option, input file, and output file)
+	if command == "compose" {
+		if len(args) < 4 {
+			return "", "", "", nil, errors.New("usage: ./bitmap compose --layer=<layer_file> [options] <source_file> <output_file>")
+		}
+
+		filename = args[len(args)-2]
+		outputFilename = args[len(args)-1]
+
+		orderedOptions, err = parseOptions(args[1 : len(args)-2])
+		if err != nil {
+			return "", "", "", nil, err
 		}
 
 		return command, filename, outputFilename, orderedOptions, nil
 	}
 
-	// If command is neither "header" nor "apply", then return an error
+	// Handle "hald" command (optional options and output file, there is no source file)
+	if command == "hald" {
+		outputFilename = args[len(args)-1]
+
+		orderedOptions, err = parseOptions(args[1 : len(args)-1])
+		if err != nil {
+			return "", "", "", nil, err
+		}
+
+		return command, "", outputFilename, orderedOptions, nil
+	}
+
+	// Handle "cube" command (requires HALD image and output .cube file)
+	if command == "cube" {
+		if len(args) < 3 {
+			return "", "", "", nil, errors.New("usage: ./bitmap cube [options] <hald_file> <output_file>")
+		}
+
+		filename = args[len(args)-2]
+		outputFilename = args[len(args)-1]
+
+		orderedOptions, err = parseOptions(args[1 : len(args)-2])
+		if err != nil {
+			return "", "", "", nil, err
+		}
+
+		return command, filename, outputFilename, orderedOptions, nil
+	}
+
+	// If command is not supported, then return an error
 	return "", "", "", nil, fmt.Errorf("unknown command: %s", command)
 }
+
+// Parses the arguments of the "montage" command: options followed by any number of source files
+// and the output file
+func ParseMontageArgs(args []string) (sourceFilenames []string, outputFilename string, orderedOptions []Option, err error) {
+	// Options come first, everything after them is a file name
+	optionCount := 0
+	for optionCount < len(args) && strings.HasPrefix(args[optionCount], "--") {
+		optionCount++
+	}
+	if len(args)-optionCount < 2 {
+		return nil, "", nil, errors.New("usage: ./bitmap montage [options] <source_file>... <output_file>")
+	}
+
+	orderedOptions, err = parseOptions(args[:optionCount])
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	return args[optionCount : len(args)-1], args[len(args)-1], orderedOptions, nil
+}
+
+// Options that are switched on by their presence and take no value
+var flagOptions = map[string]bool{
+	"--linear":     true,
+	"--explain":    true,
+	"--transpose":  true,
+	"--transverse": true,
+	"--trim":       true,
+	"--captions":   true,
+}
+
+// Parses "--name=value" arguments into a slice of options preserving their order
+func parseOptions(args []string) ([]Option, error) {
+	var orderedOptions []Option
+
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "--") {
+			return nil, fmt.Errorf("unexpected argument: %s", arg)
+		}
+
+		if flagOptions[arg] {
+			orderedOptions = append(orderedOptions, Option{Name: arg})
+			continue
+		}
+
+		// Break down the option into the option name and its associated value
+		parts := strings.SplitN(arg, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid option format: %s", arg)
+		}
+		name, value := parts[0], parts[1]
+
+		// Slice of struct preserves the insertion order of the applied options
+		orderedOptions = append(orderedOptions, Option{Name: name, Value: value})
+	}
+
+	return orderedOptions, nil
+}
+
+// Reports whether the flag option is present among the options
+func HasFlag(options []Option, name string) bool {
+	for _, opt := range options {
+		if opt.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the value of the last occurrence of the option
+func OptionValue(options []Option, name string) (string, bool) {
+	value, found := "", false
+	for _, opt := range options {
+		if opt.Name == name {
+			value, found = opt.Value, true
+		}
+	}
+	return value, found
+}
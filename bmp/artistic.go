@@ -0,0 +1,163 @@
+package bmp
+
+import "math"
+
+// Paints every pixel with the average color of the most common intensity level within the radius,
+// which turns fine detail into flat brush strokes
+func applyOilPaint(pixels []Pixel, width, height, radius, levels int) []Pixel {
+	painted := make([]Pixel, len(pixels))
+	intensity := make([]int, len(pixels))
+	for i, l := range lumaPlane(pixels) {
+		intensity[i] = min(int(l*float64(levels)/256), levels-1)
+	}
+
+	counts := make([]int, levels)
+	sums := make([][3]int, levels)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			clear(counts)
+			clear(sums)
+
+			for ny := max(y-radius, 0); ny <= min(y+radius, height-1); ny++ {
+				for nx := max(x-radius, 0); nx <= min(x+radius, width-1); nx++ {
+					idx := ny*width + nx
+					level := intensity[idx]
+					counts[level]++
+					sums[level][0] += int(pixels[idx].Red)
+					sums[level][1] += int(pixels[idx].Green)
+					sums[level][2] += int(pixels[idx].Blue)
+				}
+			}
+
+			best := 0
+			for level, count := range counts {
+				if count > counts[best] {
+					best = level
+				}
+			}
+			count := counts[best]
+			painted[y*width+x] = Pixel{
+				Red:   uint8(sums[best][0] / count),
+				Green: uint8(sums[best][1] / count),
+				Blue:  uint8(sums[best][2] / count),
+			}
+		}
+	}
+	return painted
+}
+
+// Applies the Kuwahara filter: every pixel gets the mean color of the least varying of the four
+// (radius+1)^2 quadrants around it, smoothing flat areas while keeping edges sharp
+func applyKuwahara(pixels []Pixel, width, height, radius int) []Pixel {
+	// Summed-area tables of the channels, the luma and its square, with an extra zero row and column
+	stride := width + 1
+	var integrals [5][]float64
+	for i := range integrals {
+		integrals[i] = make([]float64, stride*(height+1))
+	}
+	luma := lumaPlane(pixels)
+	for y := 0; y < height; y++ {
+		var rowSums [5]float64
+		for x := 0; x < width; x++ {
+			p, l := pixels[y*width+x], luma[y*width+x]
+			values := [5]float64{float64(p.Red), float64(p.Green), float64(p.Blue), l, l * l}
+			for i, v := range values {
+				rowSums[i] += v
+				integrals[i][(y+1)*stride+x+1] = integrals[i][y*stride+x+1] + rowSums[i]
+			}
+		}
+	}
+
+	boxSum := func(i, left, top, right, bottom int) float64 {
+		t := integrals[i]
+		return t[bottom*stride+right] - t[top*stride+right] - t[bottom*stride+left] + t[top*stride+left]
+	}
+
+	result := make([]Pixel, len(pixels))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			bestVariance := math.MaxFloat64
+			var best Pixel
+
+			for _, quadrant := range [4][2]int{{-1, -1}, {1, -1}, {-1, 1}, {1, 1}} {
+				// Quadrants share the row and column of the pixel and are clipped at the borders
+				left, right := x, x+radius
+				if quadrant[0] < 0 {
+					left, right = x-radius, x
+				}
+				top, bottom := y, y+radius
+				if quadrant[1] < 0 {
+					top, bottom = y-radius, y
+				}
+				left, top = max(left, 0), max(top, 0)
+				right, bottom = min(right, width-1)+1, min(bottom, height-1)+1
+
+				n := float64((right - left) * (bottom - top))
+				mean := boxSum(3, left, top, right, bottom) / n
+				variance := boxSum(4, left, top, right, bottom)/n - mean*mean
+				if variance < bestVariance {
+					bestVariance = variance
+					best = Pixel{
+						Red:   clampByte(boxSum(0, left, top, right, bottom) / n),
+						Green: clampByte(boxSum(1, left, top, right, bottom) / n),
+						Blue:  clampByte(boxSum(2, left, top, right, bottom) / n),
+					}
+				}
+			}
+			result[y*width+x] = best
+		}
+	}
+	return result
+}
+
+// Renders the image as a relief lit from the given direction (degrees counterclockwise from the
+// right, so 135 lights it from the top left). Gray mode shows only the relief on mid-gray,
+// otherwise the relief is added to the colors
+func applyEmboss(pixels []Pixel, width, height int, angle, strength float64, gray bool) []Pixel {
+	radians := angle * math.Pi / 180
+	lightX, lightY := math.Cos(radians), -math.Sin(radians) // Rows grow downwards
+
+	gx, gy := sobelPlane(lumaPlane(pixels), width, height)
+	for i := range pixels {
+		// Slopes facing the light get brighter, the Sobel kernel sums four times the gradient
+		relief := -(gx[i]*lightX + gy[i]*lightY) / 4 * strength
+		if gray {
+			v := clampByte(128 + relief)
+			pixels[i] = Pixel{Red: v, Green: v, Blue: v}
+			continue
+		}
+		pixels[i] = Pixel{
+			Red:   clampByte(float64(pixels[i].Red) + relief),
+			Green: clampByte(float64(pixels[i].Green) + relief),
+			Blue:  clampByte(float64(pixels[i].Blue) + relief),
+		}
+	}
+	return pixels
+}
+
+// Gives the image a cartoon look: smoothed, posterized colors with black outlines wherever the
+// Sobel edge magnitude exceeds the threshold
+func applyCartoon(pixels []Pixel, width, height, levels int, threshold, smooth float64) []Pixel {
+	if smooth > 0 {
+		var planes [3][]float64
+		for c := range planes {
+			planes[c] = make([]float64, len(pixels))
+			for i, p := range pixels {
+				planes[c][i] = float64(channel(p, c))
+			}
+			planes[c] = gaussianBlurPlane(planes[c], width, height, smooth)
+		}
+		for i := range pixels {
+			pixels[i] = Pixel{Red: clampByte(planes[0][i]), Green: clampByte(planes[1][i]), Blue: clampByte(planes[2][i])}
+		}
+	}
+
+	gx, gy := sobelPlane(lumaPlane(pixels), width, height)
+	pixels = applyPosterize(pixels, levels)
+	for i := range pixels {
+		if math.Hypot(gx[i], gy[i]) > threshold {
+			pixels[i] = black
+		}
+	}
+	return pixels
+}
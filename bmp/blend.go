@@ -0,0 +1,100 @@
+package bmp
+
+import (
+	"fmt"
+	"math"
+)
+
+// Blends a base and a layer channel value (both 0-1) into the result of a blend mode
+type blendFunc func(base, layer float64) float64
+
+// Blend modes available to the compose command
+var blendModes = map[string]blendFunc{
+	"normal":     func(a, b float64) float64 { return b },
+	"multiply":   func(a, b float64) float64 { return a * b },
+	"screen":     func(a, b float64) float64 { return 1 - (1-a)*(1-b) },
+	"overlay":    func(a, b float64) float64 { return hardLight(b, a) },
+	"darken":     math.Min,
+	"lighten":    math.Max,
+	"difference": func(a, b float64) float64 { return math.Abs(a - b) },
+	"exclusion":  func(a, b float64) float64 { return a + b - 2*a*b },
+	"color-dodge": func(a, b float64) float64 {
+		if a == 0 {
+			return 0
+		}
+		if b >= 1 {
+			return 1
+		}
+		return math.Min(1, a/(1-b))
+	},
+	"color-burn": func(a, b float64) float64 {
+		if a >= 1 {
+			return 1
+		}
+		if b <= 0 {
+			return 0
+		}
+		return 1 - math.Min(1, (1-a)/b)
+	},
+	"hard-light": hardLight,
+	"soft-light": func(a, b float64) float64 {
+		// W3C compositing formula
+		if b <= 0.5 {
+			return a - (1-2*b)*a*(1-a)
+		}
+		d := math.Sqrt(a)
+		if a <= 0.25 {
+			d = ((16*a-12)*a + 4) * a
+		}
+		return a + (2*b-1)*(d-a)
+	},
+	"add":      func(a, b float64) float64 { return math.Min(1, a+b) },
+	"subtract": func(a, b float64) float64 { return math.Max(0, a-b) },
+}
+
+// Multiplies or screens the base depending on the layer
+func hardLight(a, b float64) float64 {
+	if b <= 0.5 {
+		return a * 2 * b
+	}
+	return 1 - (1-a)*(1-(2*b-1))
+}
+
+// Blends the layer onto the pixels with the blend mode and opacity (0-1), weighted by the alpha
+// channel of the layer (nil if opaque). A layer of a different size is placed according to the
+// anchor gravity and clipped to the image
+func ApplyBlend(pixels []Pixel, width, height int, layer []Pixel, layerAlpha Mask, layerWidth, layerHeight int, mode string, opacity float64, anchor string) ([]Pixel, error) {
+	blend, ok := blendModes[mode]
+	if !ok {
+		return nil, fmt.Errorf("invalid blend mode - '%s'", mode)
+	}
+	if opacity < 0 || opacity > 1 {
+		return nil, fmt.Errorf("opacity must be between 0 and 1, got %g", opacity)
+	}
+	position, ok := gravities[anchor]
+	if !ok {
+		return nil, fmt.Errorf("invalid anchor - '%s'", anchor)
+	}
+
+	offsetX := int(math.Round(float64(width-layerWidth) * position[0]))
+	offsetY := int(math.Round(float64(height-layerHeight) * position[1]))
+
+	for ly := max(0, -offsetY); ly < layerHeight && offsetY+ly < height; ly++ {
+		for lx := max(0, -offsetX); lx < layerWidth && offsetX+lx < width; lx++ {
+			idx := (offsetY+ly)*width + offsetX + lx
+			base, top := pixels[idx], layer[ly*layerWidth+lx]
+
+			blended := Pixel{
+				Red:   clampByte(blend(float64(base.Red)/255, float64(top.Red)/255) * 255),
+				Green: clampByte(blend(float64(base.Green)/255, float64(top.Green)/255) * 255),
+				Blue:  clampByte(blend(float64(base.Blue)/255, float64(top.Blue)/255) * 255),
+			}
+			weight := opacity
+			if layerAlpha != nil {
+				weight *= layerAlpha[ly*layerWidth+lx]
+			}
+			pixels[idx] = mixPixels(base, blended, weight)
+		}
+	}
+	return pixels, nil
+}
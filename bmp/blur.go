@@ -0,0 +1,83 @@
+package bmp
+
+import "math"
+
+// Averages every pixel over samples taken along a path. The path function maps a pixel center
+// and a parameter t from -0.5 to 0.5 to a sample position, samples gives the number of samples
+func pathBlur(pixels []Pixel, width, height int, samples func(x, y float64) int, path func(x, y, t float64) (float64, float64)) []Pixel {
+	blurredPixels := make([]Pixel, len(pixels))
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			px, py := float64(x)+0.5, float64(y)+0.5
+			n := samples(px, py)
+			if n < 2 {
+				blurredPixels[y*width+x] = pixels[y*width+x]
+				continue
+			}
+
+			var sum [3]float64
+			for i := 0; i < n; i++ {
+				sx, sy := path(px, py, float64(i)/float64(n-1)-0.5)
+				sample := sampleBilinear(pixels, width, height, sx, sy)
+				sum[0] += sample[0]
+				sum[1] += sample[1]
+				sum[2] += sample[2]
+			}
+
+			blurredPixels[y*width+x] = Pixel{
+				Red:   clampByte(sum[0] / float64(n)),
+				Green: clampByte(sum[1] / float64(n)),
+				Blue:  clampByte(sum[2] / float64(n)),
+			}
+		}
+	}
+	return blurredPixels
+}
+
+// Smears the image along a line of the given length in pixels, at an angle in degrees
+// counterclockwise from the horizontal
+func applyMotionBlur(pixels []Pixel, width, height int, angle, length float64) []Pixel {
+	radians := angle * math.Pi / 180
+	dx, dy := math.Cos(radians)*length, -math.Sin(radians)*length // Rows grow downwards
+
+	return pathBlur(pixels, width, height,
+		func(x, y float64) int { return int(math.Ceil(length)) + 1 },
+		func(x, y, t float64) (float64, float64) { return x + dx*t, y + dy*t },
+	)
+}
+
+// Rotates the image back and forth around the center by the given total angle in degrees (spin blur).
+// The center is given as a fraction of the image size
+func applyRadialBlur(pixels []Pixel, width, height int, angle, centerX, centerY float64) []Pixel {
+	cx, cy := centerX*float64(width), centerY*float64(height)
+	radians := angle * math.Pi / 180
+
+	return pathBlur(pixels, width, height,
+		func(x, y float64) int {
+			arc := math.Hypot(x-cx, y-cy) * radians // Far pixels travel further and need more samples
+			return min(int(math.Ceil(arc))+1, 256)
+		},
+		func(x, y, t float64) (float64, float64) {
+			sin, cos := math.Sincos(radians * t)
+			return cx + (x-cx)*cos - (y-cy)*sin, cy + (x-cx)*sin + (y-cy)*cos
+		},
+	)
+}
+
+// Smears the image towards the center as if zooming during the exposure. The amount (0-1) is the
+// fraction of the distance to the center that every pixel is smeared over
+func applyZoomBlur(pixels []Pixel, width, height int, amount, centerX, centerY float64) []Pixel {
+	cx, cy := centerX*float64(width), centerY*float64(height)
+
+	return pathBlur(pixels, width, height,
+		func(x, y float64) int {
+			streak := math.Hypot(x-cx, y-cy) * amount
+			return min(int(math.Ceil(streak))+1, 256)
+		},
+		func(x, y, t float64) (float64, float64) {
+			scale := 1 - amount*(t+0.5)
+			return cx + (x-cx)*scale, cy + (y-cy)*scale
+		},
+	)
+}
@@ -0,0 +1,160 @@
+package bmp
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Describes how new canvas area is filled: with a solid color or from the image by edge
+// replication, mirroring or wrapping around
+type canvasFill struct {
+	mode  string // "solid", "edge", "mirror" or "wrap"
+	color Pixel
+}
+
+// Parses a fill given as a color or as one of the modes edge, mirror and wrap. Empty means black
+func parseCanvasFill(value string) (canvasFill, error) {
+	switch value {
+	case "":
+		return canvasFill{mode: "solid", color: black}, nil
+	case "edge", "mirror", "wrap":
+		return canvasFill{mode: value}, nil
+	}
+
+	color, err := ParseColor(value)
+	if err != nil {
+		return canvasFill{}, fmt.Errorf("invalid fill - '%s'", value)
+	}
+	return canvasFill{mode: "solid", color: color}, nil
+}
+
+// Adds borders around the image and its opacity (nil for an opaque image). The value is
+// "<top>,<right>,<bottom>,<left>[:<fill>]" in pixels, where one value pads all sides and two values
+// pad top and bottom, then left and right. Borders of a solid color are transparent in the opacity
+func ApplyPad(pixels []Pixel, alpha Mask, width, height int, value string) ([]Pixel, Mask, int, int, error) {
+	sizesValue, fillValue, _ := strings.Cut(value, ":")
+
+	var sizes []int
+	for _, part := range strings.Split(sizesValue, ",") {
+		size, err := strconv.Atoi(part)
+		if err != nil || size < 0 {
+			return nil, nil, 0, 0, fmt.Errorf("invalid padding - '%s'", part)
+		}
+		sizes = append(sizes, size)
+	}
+
+	var top, right, bottom, left int
+	switch len(sizes) {
+	case 1:
+		top, right, bottom, left = sizes[0], sizes[0], sizes[0], sizes[0]
+	case 2:
+		top, right, bottom, left = sizes[0], sizes[1], sizes[0], sizes[1]
+	case 4:
+		top, right, bottom, left = sizes[0], sizes[1], sizes[2], sizes[3]
+	default:
+		return nil, nil, 0, 0, fmt.Errorf("padding must have 1, 2 or 4 values, got '%s'", sizesValue)
+	}
+
+	fill, err := parseCanvasFill(fillValue)
+	if err != nil {
+		return nil, nil, 0, 0, err
+	}
+	return padImage(pixels, alpha, width, height, top, right, bottom, left, fill)
+}
+
+// Grows the canvas of the image and its opacity (nil for an opaque image) to "<W>x<H>[:<gravity>[:<fill>]]",
+// placing the image according to the gravity (center by default). The new size may not be smaller than the image
+func ApplyExtend(pixels []Pixel, alpha Mask, width, height int, value string) ([]Pixel, Mask, int, int, error) {
+	parts := strings.SplitN(value, ":", 3)
+
+	widthValue, heightValue, found := strings.Cut(parts[0], "x")
+	newWidth, errWidth := strconv.Atoi(widthValue)
+	newHeight, errHeight := strconv.Atoi(heightValue)
+	if !found || errWidth != nil || errHeight != nil {
+		return nil, nil, 0, 0, fmt.Errorf("invalid canvas size - '%s'", parts[0])
+	}
+	if newWidth < width || newHeight < height {
+		return nil, nil, 0, 0, fmt.Errorf("canvas %dx%d is smaller than the %dx%d image", newWidth, newHeight, width, height)
+	}
+
+	gravity := "center"
+	if len(parts) > 1 && parts[1] != "" {
+		gravity = parts[1]
+	}
+	anchor, ok := gravities[gravity]
+	if !ok {
+		return nil, nil, 0, 0, fmt.Errorf("invalid canvas gravity - '%s'", gravity)
+	}
+
+	fillValue := ""
+	if len(parts) > 2 {
+		fillValue = parts[2]
+	}
+	fill, err := parseCanvasFill(fillValue)
+	if err != nil {
+		return nil, nil, 0, 0, err
+	}
+
+	left := int(math.Round(float64(newWidth-width) * anchor[0]))
+	top := int(math.Round(float64(newHeight-height) * anchor[1]))
+	return padImage(pixels, alpha, width, height, top, newWidth-width-left, newHeight-height-top, left, fill)
+}
+
+// Pads the pixels and their opacity (if any) with the same borders
+func padImage(pixels []Pixel, alpha Mask, width, height, top, right, bottom, left int, fill canvasFill) ([]Pixel, Mask, int, int, error) {
+	if alpha != nil {
+		alpha, _, _, _ = padCanvas(alpha, width, height, top, right, bottom, left, fill.mode, 0)
+	}
+	pixels, width, height, err := padCanvas(pixels, width, height, top, right, bottom, left, fill.mode, fill.color)
+	return pixels, alpha, width, height, err
+}
+
+// Places the image on a larger canvas with the given borders and fills them according to the fill
+// mode, using the color for solid fills
+func padCanvas[T any](pixels []T, width, height, top, right, bottom, left int, mode string, color T) ([]T, int, int, error) {
+	newWidth, newHeight := width+left+right, height+top+bottom
+	if newWidth*newHeight > 1<<28 {
+		return nil, 0, 0, fmt.Errorf("canvas size %dx%d is not supported", newWidth, newHeight)
+	}
+
+	canvas := make([]T, newWidth*newHeight)
+	for y := 0; y < newHeight; y++ {
+		sourceY, insideY := canvasSource(y-top, height, mode)
+		for x := 0; x < newWidth; x++ {
+			sourceX, insideX := canvasSource(x-left, width, mode)
+			if !insideX || !insideY {
+				canvas[y*newWidth+x] = color
+				continue
+			}
+			canvas[y*newWidth+x] = pixels[sourceY*width+sourceX]
+		}
+	}
+	return canvas, newWidth, newHeight, nil
+}
+
+// Maps a coordinate that may lie outside of [0, size) into the image according to the fill mode.
+// Reports false if the coordinate gets a solid color
+func canvasSource(v, size int, mode string) (int, bool) {
+	if v >= 0 && v < size {
+		return v, true
+	}
+
+	switch mode {
+	case "edge":
+		return clampInt(v, 0, size-1), true
+	case "wrap":
+		return ((v % size) + size) % size, true
+	case "mirror":
+		// Reflects at the borders repeating the edge pixel: ... 2 1 0 | 0 1 2 ... size-1 | size-1 ...
+		period := 2 * size
+		m := ((v % period) + period) % period
+		if m >= size {
+			m = period - 1 - m
+		}
+		return m, true
+	default:
+		return 0, false
+	}
+}
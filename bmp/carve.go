@@ -0,0 +1,195 @@
+package bmp
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Energy added for fully protected pixels and subtracted for pixels marked for removal
+const carveMaskEnergy = 1e6
+
+// Resizes the image to "<W>x<H>" by removing or inserting seams of low energy (gradient magnitude)
+// instead of scaling, so the important content keeps its proportions. The optional "protect" and
+// "remove" masks (BMP files of the image size) keep seams away from or draw them through white areas.
+// The opacity of the image (nil if it is opaque) is carved along the same seams
+func ApplyCarve(pixels []Pixel, alpha Mask, width, height int, value string) ([]Pixel, Mask, int, int, error) {
+	params := parseFilterParams("carve", value, "size", "protect", "remove")
+	params.Require("size")
+	size := params.String("size", "")
+	protectFile := params.String("protect", "")
+	removeFile := params.String("remove", "")
+	if err := params.Err(); err != nil {
+		return nil, nil, 0, 0, err
+	}
+
+	widthValue, heightValue, found := strings.Cut(size, "x")
+	newWidth, errWidth := strconv.Atoi(widthValue)
+	newHeight, errHeight := strconv.Atoi(heightValue)
+	if !found || errWidth != nil || errHeight != nil || newWidth < 1 || newHeight < 1 {
+		return nil, nil, 0, 0, fmt.Errorf("invalid carve size - '%s'", size)
+	}
+	if newWidth > 2*width || newHeight > 2*height {
+		return nil, nil, 0, 0, fmt.Errorf("carving can at most double the image size, got %dx%d for a %dx%d image", newWidth, newHeight, width, height)
+	}
+
+	// Masks become an energy bias that travels with the pixels
+	bias := make([]float64, len(pixels))
+	for _, mask := range []struct {
+		file string
+		sign float64
+	}{{protectFile, 1}, {removeFile, -1}} {
+		if mask.file == "" {
+			continue
+		}
+		weights, err := ReadMask(mask.file, width, height)
+		if err != nil {
+			return nil, nil, 0, 0, err
+		}
+		for i, weight := range weights {
+			bias[i] += mask.sign * weight * carveMaskEnergy
+		}
+	}
+
+	pixels, bias, alpha = carveWidth(pixels, bias, alpha, width, height, newWidth)
+
+	// Rows are carved as columns of the transposed image
+	pixels, _, _ = ApplyOrientation(pixels, newWidth, height, OrientTranspose)
+	bias, _, _ = ApplyOrientation(bias, newWidth, height, OrientTranspose)
+	if alpha != nil {
+		alpha, _, _ = ApplyOrientation(alpha, newWidth, height, OrientTranspose)
+	}
+	pixels, _, alpha = carveWidth(pixels, bias, alpha, height, newWidth, newHeight)
+	pixels, _, _ = ApplyOrientation(pixels, newHeight, newWidth, OrientTranspose)
+	if alpha != nil {
+		alpha, _, _ = ApplyOrientation(alpha, newHeight, newWidth, OrientTranspose)
+	}
+
+	return pixels, alpha, newWidth, newHeight, nil
+}
+
+// Removes or inserts vertical seams in the pixels, the bias and the opacity (if any) until the
+// image has the new width
+func carveWidth(pixels []Pixel, bias []float64, alpha Mask, width, height, newWidth int) ([]Pixel, []float64, Mask) {
+	for width > newWidth {
+		seam := findSeam(pixels, bias, width, height)
+		pixels = removeSeam(pixels, width, height, seam)
+		bias = removeSeam(bias, width, height, seam)
+		if alpha != nil {
+			alpha = removeSeam(alpha, width, height, seam)
+		}
+		width--
+	}
+
+	// Inserting the lowest seams over and over would stretch a single seam, so every round
+	// duplicates at most half of the columns
+	for width < newWidth {
+		count := min(newWidth-width, max(width/2, 1))
+		duplicated := lowestSeams(pixels, bias, width, height, count)
+		pixels = duplicateSeams(pixels, width, height, duplicated, func(a, b Pixel) Pixel { return mixPixels(a, b, 0.5) })
+		bias = duplicateSeams(bias, width, height, duplicated, func(a, b float64) float64 { return math.Max(a, b) })
+		if alpha != nil {
+			alpha = duplicateSeams(alpha, width, height, duplicated, func(a, b float64) float64 { return (a + b) / 2 })
+		}
+		width += count
+	}
+	return pixels, bias, alpha
+}
+
+// Calculates the energy of every pixel as the Sobel gradient magnitude of the luma plus the mask bias
+func seamEnergy(pixels []Pixel, bias []float64, width, height int) []float64 {
+	gx, gy := sobelPlane(lumaPlane(pixels), width, height)
+	energy := make([]float64, len(pixels))
+	for i := range energy {
+		energy[i] = math.Abs(gx[i]) + math.Abs(gy[i]) + bias[i]
+	}
+	return energy
+}
+
+// Finds the connected top-to-bottom path of the lowest total energy with dynamic programming
+// and returns its column in every row
+func findSeam(pixels []Pixel, bias []float64, width, height int) []int {
+	cost := seamEnergy(pixels, bias, width, height)
+	for y := 1; y < height; y++ {
+		for x := 0; x < width; x++ {
+			best := cost[(y-1)*width+x]
+			if x > 0 {
+				best = math.Min(best, cost[(y-1)*width+x-1])
+			}
+			if x < width-1 {
+				best = math.Min(best, cost[(y-1)*width+x+1])
+			}
+			cost[y*width+x] += best
+		}
+	}
+
+	seam := make([]int, height)
+	last := (height - 1) * width
+	for x := 1; x < width; x++ {
+		if cost[last+x] < cost[last+seam[height-1]] {
+			seam[height-1] = x
+		}
+	}
+
+	// Walk back up through the cheapest neighbors
+	for y := height - 2; y >= 0; y-- {
+		x := seam[y+1]
+		best := x
+		for _, candidate := range []int{x - 1, x + 1} {
+			if candidate >= 0 && candidate < width && cost[y*width+candidate] < cost[y*width+best] {
+				best = candidate
+			}
+		}
+		seam[y] = best
+	}
+	return seam
+}
+
+// Removes the pixel of the seam from every row
+func removeSeam[T any](data []T, width, height int, seam []int) []T {
+	result := make([]T, 0, (width-1)*height)
+	for y := 0; y < height; y++ {
+		row := data[y*width : (y+1)*width]
+		result = append(result, row[:seam[y]]...)
+		result = append(result, row[seam[y]+1:]...)
+	}
+	return result
+}
+
+// Finds the given number of distinct seams by removing them one after the other from a copy and
+// returns which pixels of the image they cover
+func lowestSeams(pixels []Pixel, bias []float64, width, height, count int) []bool {
+	// Original column of every pixel of the shrinking copy
+	columns := make([]int, len(pixels))
+	for i := range columns {
+		columns[i] = i % width
+	}
+
+	covered := make([]bool, len(pixels))
+	for n := 0; n < count; n++ {
+		seam := findSeam(pixels, bias, width-n, height)
+		for y, x := range seam {
+			covered[y*width+columns[y*(width-n)+x]] = true
+		}
+		pixels = removeSeam(pixels, width-n, height, seam)
+		bias = removeSeam(bias, width-n, height, seam)
+		columns = removeSeam(columns, width-n, height, seam)
+	}
+	return covered
+}
+
+// Inserts a new pixel after every covered pixel, combined from it and its right neighbor
+func duplicateSeams[T any](data []T, width, height int, covered []bool, combine func(a, b T) T) []T {
+	var result []T
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			i := y*width + x
+			result = append(result, data[i])
+			if covered[i] {
+				result = append(result, combine(data[i], data[y*width+min(x+1, width-1)]))
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,369 @@
+package bmp
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Describes a color space the pixel channels can be converted into
+type colorSpace struct {
+	name     string
+	channels [3]string              // Channel names (e.g. "h", "s", "v")
+	ranges   [3][2]float64          // Nominal range of every channel, used to map it to 0-255
+	cyclic   [3]bool                // Channels that wrap around instead of clamping (hue)
+	from     func(Pixel) [3]float64 // Converts an sRGB pixel into the color space
+	to       func([3]float64) Pixel // Converts the color space values back to an sRGB pixel
+}
+
+// Supported color spaces. Unqualified channel names are looked up in this order
+var colorSpaces = []colorSpace{
+	{
+		name:     "rgb",
+		channels: [3]string{"r", "g", "b"},
+		ranges:   [3][2]float64{{0, 1}, {0, 1}, {0, 1}},
+		from:     func(p Pixel) [3]float64 { return pixelToRGB(p) },
+		to:       func(c [3]float64) Pixel { return rgbToPixel(c) },
+	},
+	{
+		name:     "hsv",
+		channels: [3]string{"h", "s", "v"},
+		ranges:   [3][2]float64{{0, 360}, {0, 1}, {0, 1}},
+		cyclic:   [3]bool{true, false, false},
+		from:     func(p Pixel) [3]float64 { return rgbToHSV(pixelToRGB(p)) },
+		to:       func(c [3]float64) Pixel { return rgbToPixel(hsvToRGB(c)) },
+	},
+	{
+		name:     "hsl",
+		channels: [3]string{"h", "s", "l"},
+		ranges:   [3][2]float64{{0, 360}, {0, 1}, {0, 1}},
+		cyclic:   [3]bool{true, false, false},
+		from:     func(p Pixel) [3]float64 { return rgbToHSL(pixelToRGB(p)) },
+		to:       func(c [3]float64) Pixel { return rgbToPixel(hslToRGB(c)) },
+	},
+	{
+		name:     "lab",
+		channels: [3]string{"L", "a", "b"},
+		ranges:   [3][2]float64{{0, 100}, {-128, 127}, {-128, 127}},
+		from:     func(p Pixel) [3]float64 { return rgbToLab(pixelToRGB(p)) },
+		to:       func(c [3]float64) Pixel { return rgbToPixel(labToRGB(c)) },
+	},
+	{
+		name:     "ycbcr",
+		channels: [3]string{"y", "cb", "cr"},
+		ranges:   [3][2]float64{{0, 1}, {-0.5, 0.5}, {-0.5, 0.5}},
+		from:     func(p Pixel) [3]float64 { return rgbToYCbCr(pixelToRGB(p)) },
+		to:       func(c [3]float64) Pixel { return rgbToPixel(yCbCrToRGB(c)) },
+	},
+	{
+		name:     "linear",
+		channels: [3]string{"r", "g", "b"},
+		ranges:   [3][2]float64{{0, 1}, {0, 1}, {0, 1}},
+		from: func(p Pixel) [3]float64 {
+			rgb := pixelToRGB(p)
+			return [3]float64{srgbToLinear(rgb[0]), srgbToLinear(rgb[1]), srgbToLinear(rgb[2])}
+		},
+		to: func(c [3]float64) Pixel {
+			return rgbToPixel([3]float64{linearToSRGB(c[0]), linearToSRGB(c[1]), linearToSRGB(c[2])})
+		},
+	},
+}
+
+// Applies a per-channel operation in one of the supported color spaces.
+// The value has the form "<operation>:<arguments>":
+//
+//	extract:<channel>            replaces the image with a grayscale rendering of the channel
+//	swap:<channel>,<channel>     swaps two channels of the same color space, scaled to each other's range
+//	scale:<channel>,<factor>     multiplies the channel by the factor
+//	shift:<channel>,<amount>     adds the amount (in the channel's own units) to the channel
+//
+// Channels are written as "<space>.<channel>" (e.g. "lab.L", "hsl.s") or just "<channel>",
+// in which case the first color space with that channel name is used
+func ApplyChannel(pixels []Pixel, width, height int, value string) ([]Pixel, error) {
+	operation, arguments, found := strings.Cut(value, ":")
+	if !found || arguments == "" {
+		return nil, fmt.Errorf("invalid channel operation - '%s'", value)
+	}
+	args := strings.Split(arguments, ",")
+
+	switch operation {
+	case "extract":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("extract expects one channel, got '%s'", arguments)
+		}
+		space, channel, err := lookupChannel(args[0])
+		if err != nil {
+			return nil, err
+		}
+		low, high := space.ranges[channel][0], space.ranges[channel][1]
+		for i := range pixels {
+			v := clampByte((space.from(pixels[i])[channel] - low) / (high - low) * 255)
+			pixels[i] = Pixel{Red: v, Green: v, Blue: v}
+		}
+
+	case "swap":
+		if len(args) != 2 {
+			return nil, fmt.Errorf("swap expects two channels, got '%s'", arguments)
+		}
+		space, first, err := lookupChannel(args[0])
+		if err != nil {
+			return nil, err
+		}
+		otherSpace, second, err := lookupChannel(args[1])
+		if err != nil {
+			return nil, err
+		}
+		if space.name != otherSpace.name {
+			return nil, fmt.Errorf("cannot swap channels of different color spaces (%s and %s)", space.name, otherSpace.name)
+		}
+		// Values are exchanged as fractions of their channel's range, so e.g. a hue maps onto the full saturation range
+		normalize := func(v float64, channel int) float64 {
+			low, high := space.ranges[channel][0], space.ranges[channel][1]
+			return (v - low) / (high - low)
+		}
+		denormalize := func(t float64, channel int) float64 {
+			low, high := space.ranges[channel][0], space.ranges[channel][1]
+			return low + t*(high-low)
+		}
+		for i := range pixels {
+			c := space.from(pixels[i])
+			c[first], c[second] = denormalize(normalize(c[second], second), first), denormalize(normalize(c[first], first), second)
+			pixels[i] = space.to(c)
+		}
+
+	case "scale", "shift":
+		if len(args) != 2 {
+			return nil, fmt.Errorf("%s expects a channel and a number, got '%s'", operation, arguments)
+		}
+		space, channel, err := lookupChannel(args[0])
+		if err != nil {
+			return nil, err
+		}
+		amount, err := strconv.ParseFloat(args[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s amount - '%s'", operation, args[1])
+		}
+		for i := range pixels {
+			c := space.from(pixels[i])
+			if operation == "scale" {
+				c[channel] *= amount
+			} else {
+				c[channel] += amount
+			}
+			if space.cyclic[channel] {
+				c[channel] = math.Mod(math.Mod(c[channel], space.ranges[channel][1])+space.ranges[channel][1], space.ranges[channel][1])
+			}
+			pixels[i] = space.to(c)
+		}
+
+	default:
+		return nil, fmt.Errorf("invalid channel operation - '%s'", operation)
+	}
+
+	return pixels, nil
+}
+
+// Resolves a (possibly qualified) channel name into its color space and channel index
+func lookupChannel(name string) (colorSpace, int, error) {
+	spaceName, channelName, qualified := strings.Cut(name, ".")
+	if !qualified {
+		spaceName, channelName = "", name
+	}
+
+	for _, space := range colorSpaces {
+		if qualified && space.name != strings.ToLower(spaceName) {
+			continue
+		}
+		for i, channel := range space.channels {
+			if channel == channelName {
+				return space, i, nil
+			}
+		}
+		// Channel names are case-sensitive only where it matters ("l" in HSL vs "L" in Lab)
+		for i, channel := range space.channels {
+			if qualified && strings.EqualFold(channel, channelName) {
+				return space, i, nil
+			}
+		}
+	}
+
+	return colorSpace{}, 0, fmt.Errorf("unknown color channel - '%s'", name)
+}
+
+// Converts a pixel to normalized (0-1) sRGB values in RGB order
+func pixelToRGB(p Pixel) [3]float64 {
+	return [3]float64{float64(p.Red) / 255, float64(p.Green) / 255, float64(p.Blue) / 255}
+}
+
+// Converts normalized (0-1) sRGB values in RGB order to a pixel
+func rgbToPixel(c [3]float64) Pixel {
+	return Pixel{Red: clampByte(c[0] * 255), Green: clampByte(c[1] * 255), Blue: clampByte(c[2] * 255)}
+}
+
+// Removes the sRGB transfer curve from a normalized channel value
+func srgbToLinear(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+// Applies the sRGB transfer curve to a normalized linear channel value
+func linearToSRGB(v float64) float64 {
+	if v <= 0.0031308 {
+		return v * 12.92
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+// Converts sRGB to hue (0-360), saturation and value (0-1)
+func rgbToHSV(c [3]float64) [3]float64 {
+	maxC := math.Max(c[0], math.Max(c[1], c[2]))
+	minC := math.Min(c[0], math.Min(c[1], c[2]))
+	delta := maxC - minC
+
+	var s float64
+	if maxC > 0 {
+		s = delta / maxC
+	}
+	return [3]float64{hue(c, maxC, delta), s, maxC}
+}
+
+// Converts hue (0-360), saturation and value (0-1) to sRGB
+func hsvToRGB(c [3]float64) [3]float64 {
+	h, s, v := c[0], clampFloat(c[1], 0, 1), clampFloat(c[2], 0, 1)
+	chroma := v * s
+	return hueToRGB(h, chroma, v-chroma)
+}
+
+// Converts sRGB to hue (0-360), saturation and lightness (0-1)
+func rgbToHSL(c [3]float64) [3]float64 {
+	maxC := math.Max(c[0], math.Max(c[1], c[2]))
+	minC := math.Min(c[0], math.Min(c[1], c[2]))
+	delta := maxC - minC
+	l := (maxC + minC) / 2
+
+	var s float64
+	if delta > 0 {
+		s = delta / (1 - math.Abs(2*l-1))
+	}
+	return [3]float64{hue(c, maxC, delta), s, l}
+}
+
+// Converts hue (0-360), saturation and lightness (0-1) to sRGB
+func hslToRGB(c [3]float64) [3]float64 {
+	h, s, l := c[0], clampFloat(c[1], 0, 1), clampFloat(c[2], 0, 1)
+	chroma := (1 - math.Abs(2*l-1)) * s
+	return hueToRGB(h, chroma, l-chroma/2)
+}
+
+// Calculates the hue angle shared by HSV and HSL
+func hue(c [3]float64, maxC, delta float64) float64 {
+	if delta == 0 {
+		return 0
+	}
+
+	var h float64
+	switch maxC {
+	case c[0]:
+		h = math.Mod((c[1]-c[2])/delta, 6)
+	case c[1]:
+		h = (c[2]-c[0])/delta + 2
+	default:
+		h = (c[0]-c[1])/delta + 4
+	}
+
+	h *= 60
+	if h < 0 {
+		h += 360
+	}
+	return h
+}
+
+// Builds an sRGB color from hue, chroma and the amount added to every channel
+func hueToRGB(h, chroma, m float64) [3]float64 {
+	h = math.Mod(math.Mod(h, 360)+360, 360) / 60
+	x := chroma * (1 - math.Abs(math.Mod(h, 2)-1))
+
+	var r, g, b float64
+	switch int(h) {
+	case 0:
+		r, g, b = chroma, x, 0
+	case 1:
+		r, g, b = x, chroma, 0
+	case 2:
+		r, g, b = 0, chroma, x
+	case 3:
+		r, g, b = 0, x, chroma
+	case 4:
+		r, g, b = x, 0, chroma
+	default:
+		r, g, b = chroma, 0, x
+	}
+	return [3]float64{r + m, g + m, b + m}
+}
+
+// D65 reference white used for the Lab conversion
+var whiteD65 = [3]float64{0.95047, 1.0, 1.08883}
+
+// Converts sRGB to CIE L*a*b* (D65)
+func rgbToLab(c [3]float64) [3]float64 {
+	r, g, b := srgbToLinear(c[0]), srgbToLinear(c[1]), srgbToLinear(c[2])
+
+	x := (0.4124564*r + 0.3575761*g + 0.1804375*b) / whiteD65[0]
+	y := (0.2126729*r + 0.7151522*g + 0.0721750*b) / whiteD65[1]
+	z := (0.0193339*r + 0.1191920*g + 0.9503041*b) / whiteD65[2]
+
+	fx, fy, fz := labF(x), labF(y), labF(z)
+	return [3]float64{116*fy - 16, 500 * (fx - fy), 200 * (fy - fz)}
+}
+
+// Converts CIE L*a*b* (D65) to sRGB
+func labToRGB(c [3]float64) [3]float64 {
+	fy := (c[0] + 16) / 116
+	fx := fy + c[1]/500
+	fz := fy - c[2]/200
+
+	x := labFInverse(fx) * whiteD65[0]
+	y := labFInverse(fy) * whiteD65[1]
+	z := labFInverse(fz) * whiteD65[2]
+
+	r := 3.2404542*x - 1.5371385*y - 0.4985314*z
+	g := -0.9692660*x + 1.8760108*y + 0.0415560*z
+	b := 0.0556434*x - 0.2040259*y + 1.0572252*z
+
+	return [3]float64{
+		linearToSRGB(clampFloat(r, 0, 1)),
+		linearToSRGB(clampFloat(g, 0, 1)),
+		linearToSRGB(clampFloat(b, 0, 1)),
+	}
+}
+
+func labF(t float64) float64 {
+	if t > 216.0/24389.0 {
+		return math.Cbrt(t)
+	}
+	return (24389.0/27.0*t + 16) / 116
+}
+
+func labFInverse(t float64) float64 {
+	if t*t*t > 216.0/24389.0 {
+		return t * t * t
+	}
+	return (116*t - 16) * 27.0 / 24389.0
+}
+
+// Converts sRGB to full-range YCbCr (BT.601, as used by JPEG). Cb and Cr are centered on 0
+func rgbToYCbCr(c [3]float64) [3]float64 {
+	y := 0.299*c[0] + 0.587*c[1] + 0.114*c[2]
+	return [3]float64{y, (c[2] - y) / 1.772, (c[0] - y) / 1.402}
+}
+
+// Converts full-range YCbCr (BT.601) to sRGB
+func yCbCrToRGB(c [3]float64) [3]float64 {
+	r := c[0] + 1.402*c[2]
+	b := c[0] + 1.772*c[1]
+	g := (c[0] - 0.299*r - 0.114*b) / 0.587
+	return [3]float64{r, g, b}
+}
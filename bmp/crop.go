@@ -3,22 +3,15 @@ package bmp
 import (
 	"errors"
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
 )
 
-func ApplyCrop(pixels []Pixel, width, height int, options string) ([]Pixel, int, int, error) {
-	optionSlice := strings.Split(options, "-")
-
-	optionSliceInt := []int{}
-
-	for _, option := range optionSlice {
-		num, err := strconv.Atoi(option)
-		if err != nil {
-			return nil, 0, 0, fmt.Errorf("%v", err)
-		}
-
-		optionSliceInt = append(optionSliceInt, num)
+func ApplyCrop[T any](pixels []T, width, height int, options string) ([]T, int, int, error) {
+	optionSliceInt, err := resolveCropSpec(options, width, height)
+	if err != nil {
+		return nil, 0, 0, err
 	}
 
 	offsetX, offsetY, cropWidth, cropHeight, err := parseAndValidateOptions(optionSliceInt, height, width)
@@ -27,7 +20,7 @@ func ApplyCrop(pixels []Pixel, width, height int, options string) ([]Pixel, int,
 	}
 
 	// Create new slice for cropped pixels
-	croppedPixels := make([]Pixel, cropWidth*cropHeight)
+	croppedPixels := make([]T, cropWidth*cropHeight)
 
 	// Copy the cropped part
 	for y := 0; y < cropHeight; y++ {
@@ -68,3 +61,92 @@ func parseAndValidateOptions(options []int, height, width int) (int, int, int, i
 
 	return offsetX, offsetY, cropWidth, cropHeight, nil
 }
+
+// Anchors of a crop window, as fractions of the space left around it
+var gravities = map[string][2]float64{
+	"northwest": {0, 0},
+	"north":     {0.5, 0},
+	"northeast": {1, 0},
+	"west":      {0, 0.5},
+	"center":    {0.5, 0.5},
+	"east":      {1, 0.5},
+	"southwest": {0, 1},
+	"south":     {0.5, 1},
+	"southeast": {1, 1},
+}
+
+// Converts a crop spec into explicit offsets and dimensions. Besides "<offsetX>-<offsetY>[-<width>-<height>]"
+// it accepts "center:<W>x<H>" and "gravity:<gravity>:<W>x<H>", and any value may be a percentage of the
+// image width or height (e.g. "10%-10%-80%-80%" or "center:50%x50%")
+func resolveCropSpec(spec string, width, height int) ([]int, error) {
+	var gravity string
+	var size string
+	switch {
+	case strings.HasPrefix(spec, "center:"):
+		gravity, size = "center", strings.TrimPrefix(spec, "center:")
+	case strings.HasPrefix(spec, "gravity:"):
+		var found bool
+		gravity, size, found = strings.Cut(strings.TrimPrefix(spec, "gravity:"), ":")
+		if !found {
+			return nil, fmt.Errorf("invalid crop spec - '%s'", spec)
+		}
+	}
+
+	if gravity != "" {
+		anchor, ok := gravities[gravity]
+		if !ok {
+			return nil, fmt.Errorf("invalid crop gravity - '%s'", gravity)
+		}
+		widthValue, heightValue, found := strings.Cut(size, "x")
+		if !found {
+			return nil, fmt.Errorf("invalid crop size - '%s'", size)
+		}
+		cropWidth, err := parseCropValue(widthValue, width)
+		if err != nil {
+			return nil, err
+		}
+		cropHeight, err := parseCropValue(heightValue, height)
+		if err != nil {
+			return nil, err
+		}
+		if cropWidth > width || cropHeight > height || cropWidth <= 0 || cropHeight <= 0 {
+			return nil, errors.New("crop dimensions exceed image bounds")
+		}
+
+		offsetX := int(math.Round(float64(width-cropWidth) * anchor[0]))
+		offsetY := int(math.Round(float64(height-cropHeight) * anchor[1]))
+		return []int{offsetX, offsetY, cropWidth, cropHeight}, nil
+	}
+
+	var options []int
+	for i, part := range strings.Split(spec, "-") {
+		// Even values are horizontal (offsetX, width), odd values are vertical (offsetY, height)
+		total := width
+		if i%2 == 1 {
+			total = height
+		}
+		num, err := parseCropValue(part, total)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, num)
+	}
+	return options, nil
+}
+
+// Parses a crop value given in pixels or as a percentage of the total
+func parseCropValue(value string, total int) (int, error) {
+	if percent, found := strings.CutSuffix(value, "%"); found {
+		p, err := strconv.ParseFloat(percent, 64)
+		if err != nil || p < 0 || p > 100 {
+			return 0, fmt.Errorf("invalid crop percentage - '%s'", value)
+		}
+		return int(math.Round(p / 100 * float64(total))), nil
+	}
+
+	num, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%v", err)
+	}
+	return num, nil
+}
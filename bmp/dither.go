@@ -0,0 +1,290 @@
+package bmp
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+)
+
+// Represents one neighbor of an error diffusion kernel and its share of the error
+type diffusionWeight struct {
+	dx, dy int
+	weight float64
+}
+
+// Error diffusion kernels. Weights are already divided by the kernel's divisor
+var diffusionKernels = map[string][]diffusionWeight{
+	"floyd-steinberg": normalizeKernel(16, []diffusionWeight{
+		{1, 0, 7},
+		{-1, 1, 3}, {0, 1, 5}, {1, 1, 1},
+	}),
+	"jarvis": normalizeKernel(48, []diffusionWeight{
+		{1, 0, 7}, {2, 0, 5},
+		{-2, 1, 3}, {-1, 1, 5}, {0, 1, 7}, {1, 1, 5}, {2, 1, 3},
+		{-2, 2, 1}, {-1, 2, 3}, {0, 2, 5}, {1, 2, 3}, {2, 2, 1},
+	}),
+	"stucki": normalizeKernel(42, []diffusionWeight{
+		{1, 0, 8}, {2, 0, 4},
+		{-2, 1, 2}, {-1, 1, 4}, {0, 1, 8}, {1, 1, 4}, {2, 1, 2},
+		{-2, 2, 1}, {-1, 2, 2}, {0, 2, 4}, {1, 2, 2}, {2, 2, 1},
+	}),
+	// Atkinson diffuses only 6/8 of the error, which keeps highlights and shadows clean
+	"atkinson": normalizeKernel(8, []diffusionWeight{
+		{1, 0, 1}, {2, 0, 1},
+		{-1, 1, 1}, {0, 1, 1}, {1, 1, 1},
+		{0, 2, 1},
+	}),
+	"sierra": normalizeKernel(32, []diffusionWeight{
+		{1, 0, 5}, {2, 0, 3},
+		{-2, 1, 2}, {-1, 1, 4}, {0, 1, 5}, {1, 1, 4}, {2, 1, 2},
+		{-1, 2, 2}, {0, 2, 3}, {1, 2, 2},
+	}),
+	"sierra-lite": normalizeKernel(4, []diffusionWeight{
+		{1, 0, 2},
+		{-1, 1, 1}, {0, 1, 1},
+	}),
+}
+
+func normalizeKernel(divisor float64, weights []diffusionWeight) []diffusionWeight {
+	for i := range weights {
+		weights[i].weight /= divisor
+	}
+	return weights
+}
+
+// Reduces the image to a limited set of colors, either evenly spaced levels per channel
+// (2^bits levels) or an explicit palette, spreading the quantization error with the method
+func applyDither(pixels []Pixel, width, height int, method string, bits int, palette []Pixel, serpentine bool) ([]Pixel, error) {
+	quantize := levelQuantizer(1 << bits)
+	spread := 255 / float64(int(1)<<bits-1)
+	if len(palette) > 0 {
+		quantize = paletteQuantizer(palette)
+		// Approximate distance between palette colors, assuming they are spread over the RGB cube
+		spread = 255 / math.Max(1, math.Round(math.Cbrt(float64(len(palette))))-1)
+	}
+
+	if kernel, ok := diffusionKernels[method]; ok {
+		return errorDiffusion(pixels, width, height, kernel, quantize, serpentine), nil
+	}
+
+	var matrix []float64
+	var size int
+	switch method {
+	case "bayer2":
+		matrix, size = bayerMatrix(2), 2
+	case "bayer4":
+		matrix, size = bayerMatrix(4), 4
+	case "bayer8":
+		matrix, size = bayerMatrix(8), 8
+	case "blue-noise":
+		matrix, size = blueNoiseMatrix(), blueNoiseSize
+	default:
+		return nil, fmt.Errorf("invalid dither method - '%s'", method)
+	}
+
+	return orderedDither(pixels, width, height, matrix, size, spread, quantize), nil
+}
+
+// Returns a quantizer that rounds every channel to the closest of the evenly spaced levels
+func levelQuantizer(levels int) func([3]float64) Pixel {
+	step := 255 / float64(levels-1)
+	round := func(v float64) byte {
+		return clampByte(math.Round(clampFloat(v, 0, 255)/step) * step)
+	}
+	return func(c [3]float64) Pixel {
+		return Pixel{Red: round(c[0]), Green: round(c[1]), Blue: round(c[2])}
+	}
+}
+
+// Returns a quantizer that picks the closest palette color
+func paletteQuantizer(palette []Pixel) func([3]float64) Pixel {
+	return func(c [3]float64) Pixel {
+		p := Pixel{Red: clampByte(c[0]), Green: clampByte(c[1]), Blue: clampByte(c[2])}
+		return palette[nearestColor(p, palette)]
+	}
+}
+
+// Quantizes pixels in scan order and pushes the quantization error onto unvisited neighbors.
+// Serpentine scanning reverses the direction on every other row to avoid directional artifacts
+func errorDiffusion(pixels []Pixel, width, height int, kernel []diffusionWeight, quantize func([3]float64) Pixel, serpentine bool) []Pixel {
+	values := make([][3]float64, len(pixels))
+	for i, p := range pixels {
+		values[i] = [3]float64{float64(p.Red), float64(p.Green), float64(p.Blue)}
+	}
+
+	for y := 0; y < height; y++ {
+		reverse := serpentine && y%2 == 1
+		for i := 0; i < width; i++ {
+			x, direction := i, 1
+			if reverse {
+				x, direction = width-1-i, -1
+			}
+
+			idx := y*width + x
+			quantized := quantize(values[idx])
+			pixels[idx] = quantized
+
+			errR := values[idx][0] - float64(quantized.Red)
+			errG := values[idx][1] - float64(quantized.Green)
+			errB := values[idx][2] - float64(quantized.Blue)
+
+			for _, w := range kernel {
+				nx, ny := x+w.dx*direction, y+w.dy
+				if nx < 0 || nx >= width || ny >= height {
+					continue
+				}
+				n := ny*width + nx
+				values[n][0] += errR * w.weight
+				values[n][1] += errG * w.weight
+				values[n][2] += errB * w.weight
+			}
+		}
+	}
+
+	return pixels
+}
+
+// Offsets every pixel by a threshold map value (scaled to the distance between output levels) before quantizing
+func orderedDither(pixels []Pixel, width, height int, matrix []float64, size int, spread float64, quantize func([3]float64) Pixel) []Pixel {
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			idx := y*width + x
+			offset := (matrix[(y%size)*size+x%size] - 0.5) * spread
+			p := pixels[idx]
+			pixels[idx] = quantize([3]float64{float64(p.Red) + offset, float64(p.Green) + offset, float64(p.Blue) + offset})
+		}
+	}
+	return pixels
+}
+
+// Builds a normalized (0-1) Bayer threshold matrix of the given power-of-two size
+func bayerMatrix(size int) []float64 {
+	ranks := []int{0}
+	for n := 1; n < size; n *= 2 {
+		// M(2n) = [4M, 4M+2; 4M+3, 4M+1]
+		next := make([]int, 4*n*n)
+		for y := 0; y < n; y++ {
+			for x := 0; x < n; x++ {
+				r := 4 * ranks[y*n+x]
+				next[y*2*n+x] = r
+				next[y*2*n+x+n] = r + 2
+				next[(y+n)*2*n+x] = r + 3
+				next[(y+n)*2*n+x+n] = r + 1
+			}
+		}
+		ranks = next
+	}
+
+	matrix := make([]float64, len(ranks))
+	for i, r := range ranks {
+		matrix[i] = (float64(r) + 0.5) / float64(len(ranks))
+	}
+	return matrix
+}
+
+// Size of the tileable blue-noise threshold map
+const blueNoiseSize = 64
+
+var (
+	blueNoiseOnce sync.Once
+	blueNoise     []float64
+)
+
+// Returns the blue-noise threshold map, generating it on first use
+func blueNoiseMatrix() []float64 {
+	blueNoiseOnce.Do(generateBlueNoise)
+	return blueNoise
+}
+
+// Generates a tileable blue-noise threshold map with the void-and-cluster method.
+// A fixed seed keeps the output reproducible
+func generateBlueNoise() {
+	const size = blueNoiseSize
+	const count = size * size
+	const sigma = 1.5
+
+	// Toroidal Gaussian energy contributed by a single pixel at every offset
+	var falloff [count]float64
+	for dy := 0; dy < size; dy++ {
+		for dx := 0; dx < size; dx++ {
+			wx, wy := float64(min(dx, size-dx)), float64(min(dy, size-dy))
+			falloff[dy*size+dx] = math.Exp(-(wx*wx + wy*wy) / (2 * sigma * sigma))
+		}
+	}
+
+	var energy [count]float64
+	pattern := make([]bool, count)
+	toggle := func(idx int, on bool) {
+		pattern[idx] = on
+		sign := 1.0
+		if !on {
+			sign = -1
+		}
+		px, py := idx%size, idx/size
+		for y := 0; y < size; y++ {
+			for x := 0; x < size; x++ {
+				energy[y*size+x] += sign * falloff[((y-py+size)%size)*size+(x-px+size)%size]
+			}
+		}
+	}
+	// Finds the set pixel with the highest energy (tightest cluster) or the unset one with the lowest (largest void)
+	find := func(on bool) int {
+		best := -1
+		for i := range pattern {
+			if pattern[i] != on {
+				continue
+			}
+			if best == -1 || (on && energy[i] > energy[best]) || (!on && energy[i] < energy[best]) {
+				best = i
+			}
+		}
+		return best
+	}
+
+	// Initial binary pattern: random points relaxed until evenly distributed
+	random := rand.New(rand.NewSource(1))
+	initial := count / 10
+	for placed := 0; placed < initial; {
+		idx := random.Intn(count)
+		if !pattern[idx] {
+			toggle(idx, true)
+			placed++
+		}
+	}
+	for {
+		cluster := find(true)
+		toggle(cluster, false)
+		void := find(false)
+		if void == cluster {
+			toggle(cluster, true)
+			break
+		}
+		toggle(void, true)
+	}
+
+	ranks := make([]int, count)
+	initialPattern := append([]bool(nil), pattern...)
+	initialEnergy := energy
+
+	// Rank the initial points by removing the tightest clusters first
+	for rank := initial - 1; rank >= 0; rank-- {
+		cluster := find(true)
+		toggle(cluster, false)
+		ranks[cluster] = rank
+	}
+
+	// Rank the remaining pixels by filling the largest voids
+	copy(pattern, initialPattern)
+	energy = initialEnergy
+	for rank := initial; rank < count; rank++ {
+		void := find(false)
+		toggle(void, true)
+		ranks[void] = rank
+	}
+
+	blueNoise = make([]float64, count)
+	for i, r := range ranks {
+		blueNoise[i] = (float64(r) + 0.5) / count
+	}
+}
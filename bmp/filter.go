@@ -1,14 +1,90 @@
 package bmp
 
-import "fmt"
+import (
+	"fmt"
+	"math"
+	"strings"
+)
 
-// Applies various filters like blue, red, green, grayscale, negative, pixelate or blur
+// Applies various filters like blue, red, green, grayscale, negative, pixelate or blur.
+// Filters that take parameters are written as "<filter>:<param>,<param>,..." where every
+// parameter is either positional or named ("key=value")
 func ApplyFilter(pixels []Pixel, width, height int, filterType string) ([]Pixel, error) {
+	filterType, rawParams, _ := strings.Cut(filterType, ":")
+
+	switch filterType {
+	case "blue", "red", "green", "negative":
+		// These filters take no parameters
+		if err := parseFilterParams(filterType, rawParams).Err(); err != nil {
+			return nil, err
+		}
+	}
+
 	switch filterType {
 	case "pixelate":
-		return applyPixelation(pixels, width, height, 20), nil
+		params := parseFilterParams(filterType, rawParams, "size", "style", "background", "region", "mask")
+		size := params.Int("size", 20, 2, 1024)
+		style := params.String("style", "square")
+		background := params.Color("background", black)
+		mask, err := filterMask(params, width, height)
+		if err := params.Err(); err != nil {
+			return nil, err
+		}
+		if err != nil {
+			return nil, err
+		}
+		return ApplyMasked(pixels, width, height, mask, func(pixels []Pixel, width, height int) ([]Pixel, error) {
+			return applyPixelationStyle(pixels, width, height, size, style, background)
+		})
 	case "blur":
-		return applyBlur(pixels, width, height, 25), nil
+		params := parseFilterParams(filterType, rawParams, "size", "region", "mask")
+		size := params.Int("size", 25, 1, 255)
+		mask, err := filterMask(params, width, height)
+		if err := params.Err(); err != nil {
+			return nil, err
+		}
+		if err != nil {
+			return nil, err
+		}
+		return ApplyMasked(pixels, width, height, mask, func(pixels []Pixel, width, height int) ([]Pixel, error) {
+			return applyBlur(pixels, width, height, size), nil
+		})
+	case "motion-blur":
+		params := parseFilterParams(filterType, rawParams, "angle", "length", "region", "mask")
+		angle := params.Float("angle", 0, -360, 360)
+		length := params.Float("length", 20, 1, 1000)
+		mask, err := filterMask(params, width, height)
+		if err := params.Err(); err != nil {
+			return nil, err
+		}
+		if err != nil {
+			return nil, err
+		}
+		return ApplyMasked(pixels, width, height, mask, func(pixels []Pixel, width, height int) ([]Pixel, error) {
+			return applyMotionBlur(pixels, width, height, angle, length), nil
+		})
+	case "radial-blur", "zoom-blur":
+		amountName, defaultAmount, highAmount := "angle", 10.0, 360.0
+		if filterType == "zoom-blur" {
+			amountName, defaultAmount, highAmount = "amount", 0.2, 1
+		}
+		params := parseFilterParams(filterType, rawParams, amountName, "cx", "cy", "region", "mask")
+		amount := params.Float(amountName, defaultAmount, 0, highAmount)
+		centerX := params.Float("cx", 0.5, 0, 1)
+		centerY := params.Float("cy", 0.5, 0, 1)
+		mask, err := filterMask(params, width, height)
+		if err := params.Err(); err != nil {
+			return nil, err
+		}
+		if err != nil {
+			return nil, err
+		}
+		return ApplyMasked(pixels, width, height, mask, func(pixels []Pixel, width, height int) ([]Pixel, error) {
+			if filterType == "zoom-blur" {
+				return applyZoomBlur(pixels, width, height, amount, centerX, centerY), nil
+			}
+			return applyRadialBlur(pixels, width, height, amount, centerX, centerY), nil
+		})
 	case "blue":
 		for i := range pixels {
 			pixels[i].Red = 0
@@ -25,10 +101,178 @@ func ApplyFilter(pixels []Pixel, width, height int, filterType string) ([]Pixel,
 			pixels[i].Blue = 0
 		}
 	case "grayscale":
-		for i := range pixels {
-			gray := uint8(0.299*float64(pixels[i].Red) + 0.587*float64(pixels[i].Green) + 0.114*float64(pixels[i].Blue))
-			pixels[i].Red, pixels[i].Green, pixels[i].Blue = gray, gray, gray
+		params := parseFilterParams(filterType, rawParams, "method")
+		method := params.String("method", "bt601")
+		if err := params.Err(); err != nil {
+			return nil, err
+		}
+		return applyGrayscale(pixels, method)
+	case "sepia":
+		params := parseFilterParams(filterType, rawParams, "amount")
+		amount := params.Float("amount", 1, 0, 1)
+		if err := params.Err(); err != nil {
+			return nil, err
+		}
+		return applySepia(pixels, amount), nil
+	case "duotone":
+		params := parseFilterParams(filterType, rawParams, "shadow", "highlight")
+		params.Require("shadow", "highlight")
+		shadow := params.Color("shadow", Pixel{})
+		highlight := params.Color("highlight", Pixel{})
+		if err := params.Err(); err != nil {
+			return nil, err
+		}
+		return applyDuotone(pixels, shadow, highlight), nil
+	case "colorize":
+		params := parseFilterParams(filterType, rawParams, "color", "amount")
+		params.Require("color")
+		color := params.Color("color", Pixel{})
+		amount := params.Float("amount", 1, 0, 1)
+		if err := params.Err(); err != nil {
+			return nil, err
+		}
+		return applyColorize(pixels, color, amount), nil
+	case "threshold":
+		params := parseFilterParams(filterType, rawParams, "level")
+		level := params.Float("level", 128, 0, 255)
+		if err := params.Err(); err != nil {
+			return nil, err
+		}
+		return applyThreshold(pixels, level), nil
+	case "otsu":
+		if err := parseFilterParams(filterType, rawParams).Err(); err != nil {
+			return nil, err
+		}
+		return applyOtsu(pixels), nil
+	case "adaptive":
+		params := parseFilterParams(filterType, rawParams, "method", "size", "offset")
+		method := params.String("method", "mean")
+		size := params.Int("size", 15, 3, 255)
+		offset := params.Float("offset", 5, -255, 255)
+		if err := params.Err(); err != nil {
+			return nil, err
+		}
+		return applyAdaptiveThreshold(pixels, width, height, method, size, offset)
+	case "posterize":
+		params := parseFilterParams(filterType, rawParams, "levels")
+		levels := params.Int("levels", 4, 2, 256)
+		if err := params.Err(); err != nil {
+			return nil, err
+		}
+		return applyPosterize(pixels, levels), nil
+	case "oil":
+		params := parseFilterParams(filterType, rawParams, "radius", "levels")
+		radius := params.Int("radius", 3, 1, 20)
+		levels := params.Int("levels", 20, 2, 256)
+		if err := params.Err(); err != nil {
+			return nil, err
 		}
+		return applyOilPaint(pixels, width, height, radius, levels), nil
+	case "kuwahara":
+		params := parseFilterParams(filterType, rawParams, "radius")
+		radius := params.Int("radius", 4, 1, 50)
+		if err := params.Err(); err != nil {
+			return nil, err
+		}
+		return applyKuwahara(pixels, width, height, radius), nil
+	case "emboss":
+		params := parseFilterParams(filterType, rawParams, "angle", "strength", "gray")
+		angle := params.Float("angle", 135, -360, 360)
+		strength := params.Float("strength", 1, 0, 10)
+		gray := params.Bool("gray", true)
+		if err := params.Err(); err != nil {
+			return nil, err
+		}
+		return applyEmboss(pixels, width, height, angle, strength, gray), nil
+	case "cartoon":
+		params := parseFilterParams(filterType, rawParams, "levels", "edges", "smooth")
+		levels := params.Int("levels", 6, 2, 256)
+		threshold := params.Float("edges", 150, 0, 1443) // Largest possible Sobel magnitude
+		smooth := params.Float("smooth", 1.5, 0, 20)
+		if err := params.Err(); err != nil {
+			return nil, err
+		}
+		return applyCartoon(pixels, width, height, levels, threshold, smooth), nil
+	case "dither":
+		params := parseFilterParams(filterType, rawParams, "method", "bits", "palette", "serpentine")
+		method := params.String("method", "floyd-steinberg")
+		bits := params.Int("bits", 1, 1, 7)
+		palette := params.Palette("palette")
+		serpentine := params.Bool("serpentine", false)
+		if err := params.Err(); err != nil {
+			return nil, err
+		}
+		return applyDither(pixels, width, height, method, bits, palette, serpentine)
+	case "equalize":
+		params := parseFilterParams(filterType, rawParams, "mode")
+		mode := params.String("mode", "luma")
+		if err := params.Err(); err != nil {
+			return nil, err
+		}
+		return applyEqualization(pixels, mode, equalizeChannel)
+	case "clahe":
+		params := parseFilterParams(filterType, rawParams, "tiles", "clip", "mode")
+		tiles := params.String("tiles", "8")
+		clip := params.Float("clip", 2, 1, 256)
+		mode := params.String("mode", "luma")
+		if err := params.Err(); err != nil {
+			return nil, err
+		}
+		tilesX, tilesY, err := parseTileGrid(tiles, width, height)
+		if err != nil {
+			return nil, err
+		}
+		return applyEqualization(pixels, mode, func(values []byte) []byte {
+			return claheChannel(values, width, height, tilesX, tilesY, clip)
+		})
+	case "morph":
+		params := parseFilterParams(filterType, rawParams, "op", "shape", "size", "kernel")
+		params.Require("op")
+		operation := params.String("op", "")
+		shape := params.String("shape", "square")
+		size := params.Int("size", 3, 1, 99)
+		kernel := params.String("kernel", "")
+		if err := params.Err(); err != nil {
+			return nil, err
+		}
+		element, err := newStructuringElement(shape, size, kernel)
+		if err != nil {
+			return nil, err
+		}
+		return applyMorphology(pixels, width, height, operation, element)
+	case "vignette":
+		params := parseFilterParams(filterType, rawParams, "strength", "radius", "cx", "cy")
+		strength := params.Float("strength", 0.6, 0, 1)
+		radius := params.Float("radius", 0.5, 0, 0.99)
+		centerX := params.Float("cx", 0.5, 0, 1)
+		centerY := params.Float("cy", 0.5, 0, 1)
+		if err := params.Err(); err != nil {
+			return nil, err
+		}
+		return applyVignette(pixels, width, height, strength, radius, centerX, centerY), nil
+	case "noise":
+		params := parseFilterParams(filterType, rawParams, "type", "amount", "mono", "seed")
+		noiseType := params.String("type", "gaussian")
+		defaultAmount := 20.0
+		if noiseType == "salt-pepper" {
+			defaultAmount = 0.05
+		}
+		amount := params.Float("amount", defaultAmount, 0, 255)
+		mono := params.Bool("mono", false)
+		seed := params.Int("seed", 1, math.MinInt32, math.MaxInt32)
+		if err := params.Err(); err != nil {
+			return nil, err
+		}
+		return applyNoise(pixels, noiseType, amount, mono, int64(seed))
+	case "grain":
+		params := parseFilterParams(filterType, rawParams, "amount", "size", "seed")
+		amount := params.Float("amount", 0.3, 0, 1)
+		size := params.Float("size", 1.5, 0, 10)
+		seed := params.Int("seed", 1, math.MinInt32, math.MaxInt32)
+		if err := params.Err(); err != nil {
+			return nil, err
+		}
+		return applyGrain(pixels, width, height, amount, size, int64(seed)), nil
 	case "negative":
 		for i := range pixels {
 			pixels[i].Red = 255 - pixels[i].Red
@@ -42,32 +286,28 @@ func ApplyFilter(pixels []Pixel, width, height int, filterType string) ([]Pixel,
 }
 
 // Applies pixelation to the image
-func applyPixelation(pixels []Pixel, width, height, blockSize int) []Pixel {
+func applyPixelation[T sample[T]](pixels []T, width, height, blockSize int) []T {
 	for y := 0; y < height; y += blockSize {
 		for x := 0; x < width; x += blockSize {
-			var sumR, sumG, sumB, count int
+			var sum [3]float64
+			var count int
 
 			// Collect block colors
 			for dy := 0; dy < blockSize && (y+dy) < height; dy++ {
 				for dx := 0; dx < blockSize && (x+dx) < width; dx++ {
-					idx := (y+dy)*width + (x + dx)
-					sumR += int(pixels[idx].Red)
-					sumG += int(pixels[idx].Green)
-					sumB += int(pixels[idx].Blue)
+					c := pixels[(y+dy)*width+(x+dx)].channels()
+					sum[0] += c[0]
+					sum[1] += c[1]
+					sum[2] += c[2]
 					count++
 				}
 			}
 
-			// Calculate the average color of the block
-			avgR := uint8(sumR / count)
-			avgG := uint8(sumG / count)
-			avgB := uint8(sumB / count)
-
 			// Apply the averaged color to all pixels in the block
+			avg := pixels[y*width+x].average(sum, count)
 			for dy := 0; dy < blockSize && (y+dy) < height; dy++ {
 				for dx := 0; dx < blockSize && (x+dx) < width; dx++ {
-					idx := (y+dy)*width + (x + dx)
-					pixels[idx] = Pixel{Red: avgR, Green: avgG, Blue: avgB}
+					pixels[(y+dy)*width+(x+dx)] = avg
 				}
 			}
 		}
@@ -76,40 +316,39 @@ func applyPixelation(pixels []Pixel, width, height, blockSize int) []Pixel {
 }
 
 // Applies blur to the image
-func applyBlur(pixels []Pixel, width, height int, kernelSize int) []Pixel {
-	blurredPixels := make([]Pixel, len(pixels))
+func applyBlur[T sample[T]](pixels []T, width, height int, kernelSize int) []T {
 	radius := kernelSize / 2
+
+	// The box is separable, so the kernel rows are summed first and the columns of the row sums after
+	rowSums := make([][3]float64, len(pixels))
 	for y := 0; y < height; y++ {
 		for x := 0; x < width; x++ {
-			var sumR, sumG, sumB, count int
-
-			// Iterate over the surrounding pixels in the kernel
-			for dy := -radius; dy <= radius; dy++ {
-				for dx := -radius; dx <= radius; dx++ {
-					neighborX := x + dx
-					neighborY := y + dy
-
-					// Ensure the neighboring pixel is within bounds
-					if neighborX >= 0 && neighborX < width && neighborY >= 0 && neighborY < height {
-						index := neighborY*width + neighborX
-						pixel := pixels[index]
-
-						// Sum the RGB values of the surrounding pixels
-						sumR += int(pixel.Red)
-						sumG += int(pixel.Green)
-						sumB += int(pixel.Blue)
-						count++
-					}
-				}
+			var sum [3]float64
+			for neighborX := max(x-radius, 0); neighborX <= min(x+radius, width-1); neighborX++ {
+				c := pixels[y*width+neighborX].channels()
+				sum[0] += c[0]
+				sum[1] += c[1]
+				sum[2] += c[2]
 			}
+			rowSums[y*width+x] = sum
+		}
+	}
 
-			// Apply the averaged color to the current pixel
-			newIndex := y*width + x
-			blurredPixels[newIndex] = Pixel{
-				Red:   byte(sumR / count),
-				Green: byte(sumG / count),
-				Blue:  byte(sumB / count),
+	blurredPixels := make([]T, len(pixels))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var sum [3]float64
+			for neighborY := max(y-radius, 0); neighborY <= min(y+radius, height-1); neighborY++ {
+				rowSum := rowSums[neighborY*width+x]
+				sum[0] += rowSum[0]
+				sum[1] += rowSum[1]
+				sum[2] += rowSum[2]
 			}
+
+			// Only the pixels of the kernel within bounds are averaged
+			count := (min(x+radius, width-1) - max(x-radius, 0) + 1) * (min(y+radius, height-1) - max(y-radius, 0) + 1)
+			idx := y*width + x
+			blurredPixels[idx] = pixels[idx].average(sum, count)
 		}
 	}
 
@@ -86,6 +86,36 @@ func ReadHeaders(filename string) (*BMPHeader, *DIBHeader, error) {
 	return bmpHeader, dibHeader, nil
 }
 
+// Creates BMP and DIB headers (BMP v3) for a new uncompressed 24-bit image of the given size
+func NewHeaders(width, height int) (*BMPHeader, *DIBHeader) {
+	imageSize := uint32(((width*3)+3)&^3) * uint32(height)
+
+	dibHeader := &DIBHeader{
+		DibHeaderSize: 40,
+		Width:         int32(width),
+		Height:        int32(height),
+		Planes:        1,
+		BitCount:      24,
+		ImageSize:     imageSize,
+		XPixelsPerM:   2835, // 72 DPI
+		YPixelsPerM:   2835,
+	}
+	bmpHeader := &BMPHeader{
+		Signature:  [2]byte{'B', 'M'},
+		FileSize:   54 + imageSize,
+		DataOffset: 54,
+	}
+
+	return bmpHeader, dibHeader
+}
+
+// Updates the image dimensions and the size of the 24-bit pixel data after a geometric change
+func (dibHeader *DIBHeader) SetDimensions(width, height int) {
+	dibHeader.Width = int32(width)
+	dibHeader.Height = int32(height)
+	dibHeader.ImageSize = uint32(((width*3)+3)&^3) * uint32(height)
+}
+
 func validateFile(bmpHeader BMPHeader, dibHeader DIBHeader, filename string, fileInfo fs.FileInfo) error {
 	// Ensure that it is a valid BMP file
 	if string(bmpHeader.Signature[:]) != "BM" {
@@ -0,0 +1,182 @@
+package bmp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Builds the mapping that spreads the histogram evenly over 0-255 (its normalized cumulative distribution)
+func equalizationMapping(histogram [256]float64) [256]byte {
+	var mapping [256]byte
+	var total, cdfMin float64
+	for _, count := range histogram {
+		total += count
+	}
+
+	var cumulative float64
+	for v, count := range histogram {
+		cumulative += count
+		if cdfMin == 0 {
+			cdfMin = cumulative
+		}
+		if total == cdfMin {
+			mapping[v] = byte(v) // Single-valued histogram, nothing to spread
+			continue
+		}
+		mapping[v] = clampByte((cumulative - cdfMin) / (total - cdfMin) * 255)
+	}
+	return mapping
+}
+
+// Equalizes a single channel over the whole image
+func equalizeChannel(values []byte) []byte {
+	var histogram [256]float64
+	for _, v := range values {
+		histogram[v]++
+	}
+
+	mapping := equalizationMapping(histogram)
+	for i, v := range values {
+		values[i] = mapping[v]
+	}
+	return values
+}
+
+// Applies contrast limited adaptive histogram equalization to a single channel. Every tile gets its own
+// equalization with the histogram clipped at clipLimit times the average bin count, and pixels blend
+// the mappings of the four closest tile centers to avoid visible tile borders
+func claheChannel(values []byte, width, height, tilesX, tilesY int, clipLimit float64) []byte {
+	tileWidth := float64(width) / float64(tilesX)
+	tileHeight := float64(height) / float64(tilesY)
+	mappings := make([][256]byte, tilesX*tilesY)
+
+	for ty := 0; ty < tilesY; ty++ {
+		for tx := 0; tx < tilesX; tx++ {
+			x0, x1 := int(float64(tx)*tileWidth), int(float64(tx+1)*tileWidth)
+			y0, y1 := int(float64(ty)*tileHeight), int(float64(ty+1)*tileHeight)
+
+			var histogram [256]float64
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					histogram[values[y*width+x]]++
+				}
+			}
+
+			// Clip the histogram and redistribute the excess evenly over all bins
+			limit := max(1, clipLimit*float64((x1-x0)*(y1-y0))/256)
+			var excess float64
+			for v := range histogram {
+				if histogram[v] > limit {
+					excess += histogram[v] - limit
+					histogram[v] = limit
+				}
+			}
+			for v := range histogram {
+				histogram[v] += excess / 256
+			}
+
+			mappings[ty*tilesX+tx] = claheMapping(histogram)
+		}
+	}
+
+	result := make([]byte, len(values))
+	for y := 0; y < height; y++ {
+		// Position relative to the tile centers
+		fy := clampFloat((float64(y)+0.5)/tileHeight-0.5, 0, float64(tilesY-1))
+		ty0 := min(int(fy), tilesY-1)
+		ty1 := min(ty0+1, tilesY-1)
+		wy := fy - float64(ty0)
+
+		for x := 0; x < width; x++ {
+			fx := clampFloat((float64(x)+0.5)/tileWidth-0.5, 0, float64(tilesX-1))
+			tx0 := min(int(fx), tilesX-1)
+			tx1 := min(tx0+1, tilesX-1)
+			wx := fx - float64(tx0)
+
+			v := values[y*width+x]
+			top := float64(mappings[ty0*tilesX+tx0][v])*(1-wx) + float64(mappings[ty0*tilesX+tx1][v])*wx
+			bottom := float64(mappings[ty1*tilesX+tx0][v])*(1-wx) + float64(mappings[ty1*tilesX+tx1][v])*wx
+			result[y*width+x] = clampByte(top*(1-wy) + bottom*wy)
+		}
+	}
+	return result
+}
+
+// Builds the cumulative distribution mapping of a clipped tile histogram
+func claheMapping(histogram [256]float64) [256]byte {
+	var mapping [256]byte
+	var total, cumulative float64
+	for _, count := range histogram {
+		total += count
+	}
+	for v, count := range histogram {
+		cumulative += count
+		mapping[v] = clampByte(cumulative / total * 255)
+	}
+	return mapping
+}
+
+// Equalizes the image either on its luma (keeping the colors) or on every channel separately,
+// with a global or a contrast limited adaptive (CLAHE) mapping
+func applyEqualization(pixels []Pixel, mode string, equalize func([]byte) []byte) ([]Pixel, error) {
+	switch mode {
+	case "luma":
+		ycbcr := make([][3]float64, len(pixels))
+		luma := make([]byte, len(pixels))
+		for i, p := range pixels {
+			ycbcr[i] = rgbToYCbCr(pixelToRGB(p))
+			luma[i] = clampByte(ycbcr[i][0] * 255)
+		}
+
+		luma = equalize(luma)
+		for i := range pixels {
+			ycbcr[i][0] = float64(luma[i]) / 255
+			pixels[i] = rgbToPixel(yCbCrToRGB(ycbcr[i]))
+		}
+
+	case "channels":
+		for c := 0; c < 3; c++ {
+			values := make([]byte, len(pixels))
+			for i, p := range pixels {
+				values[i] = channel(p, c)
+			}
+
+			values = equalize(values)
+			for i := range pixels {
+				switch c {
+				case 0:
+					pixels[i].Red = values[i]
+				case 1:
+					pixels[i].Green = values[i]
+				default:
+					pixels[i].Blue = values[i]
+				}
+			}
+		}
+
+	default:
+		return nil, fmt.Errorf("invalid equalization mode - '%s'", mode)
+	}
+
+	return pixels, nil
+}
+
+// Parses a tile grid given as "<n>" (n x n tiles) or "<columns>x<rows>"
+func parseTileGrid(value string, width, height int) (int, int, error) {
+	columnsValue, rowsValue, found := strings.Cut(value, "x")
+	if !found {
+		rowsValue = columnsValue
+	}
+
+	columns, errColumns := strconv.Atoi(columnsValue)
+	rows, errRows := strconv.Atoi(rowsValue)
+	if errColumns != nil || errRows != nil || columns < 1 || rows < 1 {
+		return 0, 0, fmt.Errorf("invalid tile grid - '%s'", value)
+	}
+	if columns > width || rows > height {
+		return 0, 0, fmt.Errorf("tile grid %dx%d is larger than the %dx%d image", columns, rows, width, height)
+	}
+
+	return columns, rows, nil
+}
@@ -4,7 +4,9 @@ import (
 	"bufio"
 	"encoding/binary"
 	"fmt"
+	"io"
 	"os"
+	"strconv"
 )
 
 // Represents a single pixel in the image (for 24-bit BMP files)
@@ -64,6 +66,88 @@ func ReadPixels(filename string, bmpHeader *BMPHeader, dibHeader *DIBHeader) ([]
 	return pixels, nil
 }
 
+// Reads a 24-bit BMP file or a 32-bit BMP file with an alpha channel, such as the transparent files
+// written by WriteAlpha. Returns the pixels with their opacity (nil for an opaque image) and the DIB header
+func ReadImage(filename string) ([]Pixel, Mask, *DIBHeader, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("error opening file - %v", err)
+	}
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("error getting file info - %v", err)
+	}
+	if fileInfo.Size() < 54 {
+		return nil, nil, nil, fmt.Errorf("%s is not a valid BMP file", filename)
+	}
+
+	bmpHeader, dibHeader, err := readHeaders(file)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if dibHeader.BitCount != 32 {
+		bmpHeader, dibHeader, err = ReadHeaders(filename)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		pixels, err := ReadPixels(filename, bmpHeader, dibHeader)
+		return pixels, nil, dibHeader, err
+	}
+
+	// Only the byte layout written by WriteAlpha (blue, green, red, alpha) is supported. Files without
+	// bit masks store an unused fourth byte instead of the alpha
+	hasAlpha := false
+	switch {
+	case string(bmpHeader.Signature[:]) != "BM":
+		return nil, nil, nil, fmt.Errorf("%s is not a valid BMP file", filename)
+	case dibHeader.Compression == 3 && dibHeader.DibHeaderSize >= 108:
+		if dibHeader.RedMask != 0x00FF0000 || dibHeader.GreenMask != 0x0000FF00 || dibHeader.BlueMask != 0x000000FF ||
+			(dibHeader.AlphaMask != 0xFF000000 && dibHeader.AlphaMask != 0) {
+			return nil, nil, nil, fmt.Errorf("%s has unsupported 32-bit channel masks", filename)
+		}
+		hasAlpha = dibHeader.AlphaMask != 0
+	case dibHeader.Compression != 0:
+		return nil, nil, nil, fmt.Errorf("%s is a compressed BMP file (Compression = %d), which is not supported", filename, dibHeader.Compression)
+	}
+	if dibHeader.Width <= 0 || dibHeader.Height <= 0 || dibHeader.Width > 65536 || dibHeader.Height > 65536 {
+		return nil, nil, nil, fmt.Errorf("%s has an unsupported size %dx%d", filename, dibHeader.Width, dibHeader.Height)
+	}
+
+	width, height := int(dibHeader.Width), int(dibHeader.Height)
+	if fileInfo.Size() < int64(bmpHeader.DataOffset)+int64(width*height*4) {
+		return nil, nil, nil, fmt.Errorf("%s is corrupted or incomplete (file size too small)", filename)
+	}
+	if _, err := file.Seek(int64(bmpHeader.DataOffset), 0); err != nil {
+		return nil, nil, nil, fmt.Errorf("error seeking to pixel data - %v", err)
+	}
+
+	pixels := make([]Pixel, width*height)
+	var alpha Mask
+	if hasAlpha {
+		alpha = make(Mask, width*height)
+	}
+	reader := bufio.NewReader(file)
+	buf := make([]byte, width*4) // 32-bit rows are always aligned
+
+	// Read pixel data (BMP stores pixels bottom-up)
+	for y := height - 1; y >= 0; y-- {
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			return nil, nil, nil, fmt.Errorf("error reading pixel data: %v", err)
+		}
+		for x := 0; x < width; x++ {
+			idx := y*width + x
+			pixels[idx] = Pixel{Blue: buf[x*4], Green: buf[x*4+1], Red: buf[x*4+2]}
+			if hasAlpha {
+				alpha[idx] = float64(buf[x*4+3]) / 255
+			}
+		}
+	}
+
+	return pixels, alpha, dibHeader, nil
+}
+
 // Writes the modified pixel data to an output BMP file
 func WritePixels(filename string, bmpHeader *BMPHeader, dibHeader *DIBHeader, pixels []Pixel) error {
 	// Create the output BMP file
@@ -73,15 +157,20 @@ func WritePixels(filename string, bmpHeader *BMPHeader, dibHeader *DIBHeader, pi
 	}
 	defer file.Close()
 
-	err = writeHeaders(file, *bmpHeader, *dibHeader)
+	width, height := int(dibHeader.Width), int(dibHeader.Height)
+	rowSize := ((width * 3) + 3) &^ 3 // Align to 4-byte boundary
+	padding := rowSize - (width * 3)
+
+	// The size of the image may have changed since the headers were read
+	header := *bmpHeader
+	header.FileSize = header.DataOffset + uint32(rowSize*height)
+
+	err = writeHeaders(file, header, *dibHeader)
 	if err != nil {
 		return fmt.Errorf("%v", err)
 	}
 
 	writer := bufio.NewWriter(file)
-	width, height := int(dibHeader.Width), int(dibHeader.Height)
-	rowSize := ((width * 3) + 3) &^ 3 // Align to 4-byte boundary
-	padding := rowSize - (width * 3)
 	paddingBytes := make([]byte, padding)
 
 	rowBuffer := make([]byte, rowSize)
@@ -105,6 +194,190 @@ func WritePixels(filename string, bmpHeader *BMPHeader, dibHeader *DIBHeader, pi
 	return writer.Flush()
 }
 
+// Writes the pixels using the output settings among the options: --bits selects the bit depth and
+// --quantize=<colors>[:<method>] generates an optimal palette for an indexed file. An image with
+// transparency (a non-nil alpha) is always written as a 32-bit file
+func WriteOutput(filename string, bmpHeader *BMPHeader, dibHeader *DIBHeader, pixels []Pixel, alpha Mask, options []Option) error {
+	bitsValue, hasBits := OptionValue(options, "--bits")
+	quantizeValue, hasQuantize := OptionValue(options, "--quantize")
+
+	bits := 24
+	if alpha != nil {
+		bits = 32
+	}
+	if hasBits {
+		var err error
+		bits, err = strconv.Atoi(bitsValue)
+		if err != nil || (bits != 1 && bits != 4 && bits != 8 && bits != 24 && bits != 32) {
+			return fmt.Errorf("unsupported output bit depth - '%s'", bitsValue)
+		}
+	}
+	if alpha != nil && (bits != 32 || hasQuantize) {
+		return fmt.Errorf("transparency can only be written to a 32-bit BMP file")
+	}
+
+	if !hasQuantize {
+		switch bits {
+		case 32:
+			return WriteAlpha(filename, dibHeader, pixels, alpha)
+		case 24:
+			return WritePixels(filename, bmpHeader, dibHeader, pixels)
+		case 1:
+			return WriteIndexed(filename, dibHeader, pixels, BlackAndWhitePalette, 1)
+		}
+		// 4 and 8-bit files get the largest palette they can hold
+		quantizeValue = strconv.Itoa(1 << bits)
+	}
+
+	colors, method, err := ParseQuantizeValue(quantizeValue)
+	if err != nil {
+		return err
+	}
+
+	palette, err := Quantize(pixels, colors, method)
+	if err != nil {
+		return err
+	}
+
+	// Use the smallest bit depth that holds the palette unless one was requested
+	if !hasBits {
+		switch {
+		case len(palette) <= 2:
+			bits = 1
+		case len(palette) <= 16:
+			bits = 4
+		default:
+			bits = 8
+		}
+	}
+	if bits >= 24 || len(palette) > 1<<bits {
+		return fmt.Errorf("a palette of %d colors does not fit into a %d-bit BMP file", len(palette), bits)
+	}
+
+	return WriteIndexed(filename, dibHeader, pixels, palette, bits)
+}
+
+// Writes the pixels to an indexed (1, 4 or 8-bit) BMP file. Every pixel is stored as the index
+// of its closest palette color
+func WriteIndexed(filename string, dibHeader *DIBHeader, pixels []Pixel, palette []Pixel, bitCount int) error {
+	if bitCount != 1 && bitCount != 4 && bitCount != 8 {
+		return fmt.Errorf("unsupported indexed bit depth - %d", bitCount)
+	}
+	if len(palette) == 0 || len(palette) > 1<<bitCount {
+		return fmt.Errorf("a %d-bit BMP file needs between 1 and %d palette colors, got %d", bitCount, 1<<bitCount, len(palette))
+	}
+
+	width, height := int(dibHeader.Width), int(dibHeader.Height)
+	rowSize := ((width*bitCount + 31) / 32) * 4 // Align to 4-byte boundary
+	paletteSize := uint32(len(palette) * 4)
+
+	// Indexed files are always written with a BMP v3 header followed by the palette
+	bmpHeader, indexedHeader := NewHeaders(width, height)
+	indexedHeader.BitCount = uint16(bitCount)
+	indexedHeader.ImageSize = uint32(rowSize * height)
+	indexedHeader.XPixelsPerM = dibHeader.XPixelsPerM
+	indexedHeader.YPixelsPerM = dibHeader.YPixelsPerM
+	indexedHeader.ColorsUsed = uint32(len(palette))
+	bmpHeader.DataOffset = 54 + paletteSize
+	bmpHeader.FileSize = bmpHeader.DataOffset + indexedHeader.ImageSize
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("error creating output file - %v", err)
+	}
+	defer file.Close()
+
+	err = writeHeaders(file, *bmpHeader, *indexedHeader)
+	if err != nil {
+		return fmt.Errorf("%v", err)
+	}
+
+	writer := bufio.NewWriter(file)
+
+	// Palette entries are stored as blue, green, red and a reserved byte
+	for _, color := range palette {
+		if _, err := writer.Write([]byte{color.Blue, color.Green, color.Red, 0}); err != nil {
+			return fmt.Errorf("error writing palette: %v", err)
+		}
+	}
+
+	indices := paletteIndices(pixels, palette)
+	pixelsPerByte := 8 / bitCount
+	rowBuffer := make([]byte, rowSize)
+
+	for y := height - 1; y >= 0; y-- {
+		clear(rowBuffer)
+		for x := 0; x < width; x++ {
+			// Pack indices starting from the most significant bits
+			shift := uint(8 - bitCount*(x%pixelsPerByte+1))
+			rowBuffer[x/pixelsPerByte] |= indices[y*width+x] << shift
+		}
+
+		_, err = writer.Write(rowBuffer)
+		if err != nil {
+			return fmt.Errorf("error writing pixel row: %v", err)
+		}
+	}
+
+	return writer.Flush()
+}
+
+// Writes the pixels with their opacity to a 32-bit BMP file. The file gets a BMP v4 header whose
+// bit masks declare the alpha channel. A nil alpha writes a fully opaque image
+func WriteAlpha(filename string, dibHeader *DIBHeader, pixels []Pixel, alpha Mask) error {
+	width, height := int(dibHeader.Width), int(dibHeader.Height)
+
+	bmpHeader, alphaHeader := NewHeaders(width, height)
+	alphaHeader.DibHeaderSize = 108
+	alphaHeader.BitCount = 32
+	alphaHeader.Compression = 3 // BI_BITFIELDS
+	alphaHeader.ImageSize = uint32(width * height * 4)
+	alphaHeader.XPixelsPerM = dibHeader.XPixelsPerM
+	alphaHeader.YPixelsPerM = dibHeader.YPixelsPerM
+	alphaHeader.RedMask = 0x00FF0000
+	alphaHeader.GreenMask = 0x0000FF00
+	alphaHeader.BlueMask = 0x000000FF
+	alphaHeader.AlphaMask = 0xFF000000
+	alphaHeader.ColorSpace = 0x73524742 // "sRGB"
+	bmpHeader.DataOffset = 14 + 108
+	bmpHeader.FileSize = bmpHeader.DataOffset + alphaHeader.ImageSize
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("error creating output file - %v", err)
+	}
+	defer file.Close()
+
+	err = writeHeaders(file, *bmpHeader, *alphaHeader)
+	if err != nil {
+		return fmt.Errorf("%v", err)
+	}
+
+	writer := bufio.NewWriter(file)
+	rowBuffer := make([]byte, width*4) // 32-bit rows are always aligned
+
+	for y := height - 1; y >= 0; y-- {
+		for x := 0; x < width; x++ {
+			idx := y*width + x
+			offset := x * 4
+			rowBuffer[offset] = pixels[idx].Blue
+			rowBuffer[offset+1] = pixels[idx].Green
+			rowBuffer[offset+2] = pixels[idx].Red
+			rowBuffer[offset+3] = 255
+			if alpha != nil {
+				rowBuffer[offset+3] = clampByte(alpha[idx] * 255)
+			}
+		}
+
+		_, err = writer.Write(rowBuffer)
+		if err != nil {
+			return fmt.Errorf("error writing pixel row: %v", err)
+		}
+	}
+
+	return writer.Flush()
+}
+
 func writeHeaders(file *os.File, bmpHeader BMPHeader, dibHeader DIBHeader) error {
 	// Write BMP Header (Only first 14 bytes)
 	err := binary.Write(file, binary.LittleEndian, bmpHeader.Signature)
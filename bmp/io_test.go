@@ -0,0 +1,182 @@
+package bmp
+
+import (
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// Decodes an indexed BMP file written by WriteIndexed into its pixels, size and bit depth
+func readIndexed(t *testing.T, filename string) ([]Pixel, int, int, int) {
+	t.Helper()
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fileSize := binary.LittleEndian.Uint32(data[2:]); int(fileSize) != len(data) {
+		t.Errorf("header file size is %d, the file has %d bytes", fileSize, len(data))
+	}
+	dataOffset := int(binary.LittleEndian.Uint32(data[10:]))
+	width := int(binary.LittleEndian.Uint32(data[18:]))
+	height := int(binary.LittleEndian.Uint32(data[22:]))
+	bitCount := int(binary.LittleEndian.Uint16(data[28:]))
+	colorsUsed := int(binary.LittleEndian.Uint32(data[46:]))
+
+	palette := make([]Pixel, colorsUsed)
+	for i := range palette {
+		entry := data[54+i*4:]
+		palette[i] = Pixel{Blue: entry[0], Green: entry[1], Red: entry[2]}
+	}
+
+	rowSize := ((width*bitCount + 31) / 32) * 4
+	pixelsPerByte := 8 / bitCount
+	pixels := make([]Pixel, width*height)
+	for y := 0; y < height; y++ {
+		row := data[dataOffset+(height-1-y)*rowSize:]
+		for x := 0; x < width; x++ {
+			shift := 8 - bitCount*(x%pixelsPerByte+1)
+			index := int(row[x/pixelsPerByte]>>shift) & (1<<bitCount - 1)
+			if index >= len(palette) {
+				t.Fatalf("pixel %d,%d has index %d outside of the palette of %d colors", x, y, index, len(palette))
+			}
+			pixels[y*width+x] = palette[index]
+		}
+	}
+	return pixels, width, height, bitCount
+}
+
+// Builds an image of the given size that cycles through the palette
+func paletteImage(palette []Pixel, width, height int) []Pixel {
+	pixels := make([]Pixel, width*height)
+	for i := range pixels {
+		pixels[i] = palette[(i*7+i/width)%len(palette)]
+	}
+	return pixels
+}
+
+func TestWriteIndexedRoundTrip(t *testing.T) {
+	colors := make([]Pixel, 256)
+	for i := range colors {
+		colors[i] = Pixel{Red: byte(i), Green: byte(255 - i), Blue: byte(i / 2)}
+	}
+
+	tests := []struct {
+		name          string
+		palette       []Pixel
+		bitCount      int
+		width, height int
+	}{
+		{"1-bit narrow", BlackAndWhitePalette, 1, 3, 2},
+		{"1-bit unaligned", BlackAndWhitePalette, 1, 37, 5},
+		{"4-bit full palette", colors[:16], 4, 9, 4},
+		{"4-bit small palette", colors[:3], 4, 1, 7},
+		{"8-bit full palette", colors, 8, 23, 11},
+		{"8-bit small palette", colors[:5], 8, 6, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pixels := paletteImage(tt.palette, tt.width, tt.height)
+			_, dibHeader := NewHeaders(tt.width, tt.height)
+
+			filename := filepath.Join(t.TempDir(), "indexed.bmp")
+			if err := WriteIndexed(filename, dibHeader, pixels, tt.palette, tt.bitCount); err != nil {
+				t.Fatalf("WriteIndexed failed: %v", err)
+			}
+
+			got, width, height, bitCount := readIndexed(t, filename)
+			if width != tt.width || height != tt.height || bitCount != tt.bitCount {
+				t.Fatalf("read a %dx%d %d-bit image, want %dx%d %d-bit", width, height, bitCount, tt.width, tt.height, tt.bitCount)
+			}
+			if !slices.Equal(got, pixels) {
+				t.Errorf("pixels read back differ from the pixels written")
+			}
+		})
+	}
+}
+
+func TestWriteIndexedErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		palette  []Pixel
+		bitCount int
+	}{
+		{"unsupported bit depth", BlackAndWhitePalette, 2},
+		{"empty palette", nil, 8},
+		{"palette too large", make([]Pixel, 3), 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, dibHeader := NewHeaders(2, 2)
+			filename := filepath.Join(t.TempDir(), "indexed.bmp")
+			if err := WriteIndexed(filename, dibHeader, make([]Pixel, 4), tt.palette, tt.bitCount); err == nil {
+				t.Error("WriteIndexed succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestWriteAlphaRoundTrip(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		opaque        bool
+	}{
+		{"single pixel", 1, 1, false},
+		{"odd width", 7, 3, false},
+		{"wide", 64, 2, false},
+		{"opaque", 5, 4, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pixels := paletteImage([]Pixel{{Red: 10, Green: 20, Blue: 30}, {Red: 250}, {Green: 128, Blue: 255}}, tt.width, tt.height)
+			var alpha Mask
+			if !tt.opaque {
+				alpha = make(Mask, len(pixels))
+				for i := range alpha {
+					alpha[i] = float64(i*37%256) / 255
+				}
+			}
+			_, dibHeader := NewHeaders(tt.width, tt.height)
+
+			filename := filepath.Join(t.TempDir(), "alpha.bmp")
+			if err := WriteAlpha(filename, dibHeader, pixels, alpha); err != nil {
+				t.Fatalf("WriteAlpha failed: %v", err)
+			}
+
+			data, err := os.ReadFile(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fileSize := binary.LittleEndian.Uint32(data[2:]); int(fileSize) != len(data) {
+				t.Errorf("header file size is %d, the file has %d bytes", fileSize, len(data))
+			}
+
+			got, gotAlpha, gotHeader, err := ReadImage(filename)
+			if err != nil {
+				t.Fatalf("ReadImage failed: %v", err)
+			}
+			if int(gotHeader.Width) != tt.width || int(gotHeader.Height) != tt.height || gotHeader.BitCount != 32 {
+				t.Fatalf("read a %dx%d %d-bit image, want %dx%d 32-bit", gotHeader.Width, gotHeader.Height, gotHeader.BitCount, tt.width, tt.height)
+			}
+			if !slices.Equal(got, pixels) {
+				t.Errorf("pixels read back differ from the pixels written")
+			}
+			for i := range pixels {
+				want := 1.0
+				if alpha != nil {
+					want = alpha[i]
+				}
+				if math.Abs(gotAlpha[i]-want) > 1e-9 {
+					t.Errorf("alpha of pixel %d = %g, want %g", i, gotAlpha[i], want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package bmp
+
+import "math"
+
+// Corrects lens distortion with the Brown-Conrady model: radial coefficients k1, k2, k3 and
+// tangential coefficients p1, p2 describe where the lens moved every point, relative to the image
+// center with the half diagonal as unit length. Negative k1 is barrel distortion. The reverse mode
+// applies the distortion instead of removing it, e.g. to simulate a lens for testing. Returns the
+// inverse mapping of the correction
+func lensMapping(width, height int, coefficients [5]float64, reverse bool) func(x, y float64) (float64, float64) {
+	k1, k2, k3, p1, p2 := coefficients[0], coefficients[1], coefficients[2], coefficients[3], coefficients[4]
+	cx, cy := float64(width)/2, float64(height)/2
+	unit := math.Hypot(cx, cy)
+
+	// Maps an undistorted point to where the lens shows it
+	distort := func(x, y float64) (float64, float64) {
+		r2 := x*x + y*y
+		radial := 1 + k1*r2 + k2*r2*r2 + k3*r2*r2*r2
+		return x*radial + 2*p1*x*y + p2*(r2+2*x*x), y*radial + p1*(r2+2*y*y) + 2*p2*x*y
+	}
+
+	return func(x, y float64) (float64, float64) {
+		x, y = (x-cx)/unit, (y-cy)/unit
+		if reverse {
+			// The output shows the distortion, so find the undistorted point by fixed-point iteration
+			ux, uy := x, y
+			for i := 0; i < 20; i++ {
+				dx, dy := distort(ux, uy)
+				ux, uy = ux+x-dx, uy+y-dy
+			}
+			x, y = ux, uy
+		} else {
+			x, y = distort(x, y)
+		}
+		return x*unit + cx, y*unit + cy
+	}
+}
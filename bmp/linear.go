@@ -0,0 +1,185 @@
+package bmp
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Represents a single pixel of the high-precision linear-light working buffer.
+// Channels are normalized to 0-1 with the sRGB transfer curve removed
+type LinearPixel struct {
+	Blue  float32
+	Green float32
+	Red   float32
+}
+
+// Lookup table from 8-bit sRGB values to linear light
+var srgbToLinearTable = func() [256]float32 {
+	var table [256]float32
+	for i := range table {
+		table[i] = float32(srgbToLinear(float64(i) / 255))
+	}
+	return table
+}()
+
+// Converts 8-bit sRGB pixels into a linear-light working buffer
+func ToLinear(pixels []Pixel) []LinearPixel {
+	linear := make([]LinearPixel, len(pixels))
+	for i, p := range pixels {
+		linear[i] = LinearPixel{
+			Blue:  srgbToLinearTable[p.Blue],
+			Green: srgbToLinearTable[p.Green],
+			Red:   srgbToLinearTable[p.Red],
+		}
+	}
+	return linear
+}
+
+// Converts a linear-light working buffer back to 8-bit sRGB pixels
+func FromLinear(linear []LinearPixel) []Pixel {
+	pixels := make([]Pixel, len(linear))
+	for i, p := range linear {
+		pixels[i] = Pixel{
+			Blue:  clampByte(linearToSRGB(float64(p.Blue)) * 255),
+			Green: clampByte(linearToSRGB(float64(p.Green)) * 255),
+			Red:   clampByte(linearToSRGB(float64(p.Red)) * 255),
+		}
+	}
+	return pixels
+}
+
+// Represents a pixel type the averaging kernels work on: 8-bit pixels or the linear-light buffer
+type sample[T any] interface {
+	Pixel | LinearPixel
+	channels() [3]float64                // Red, green and blue values
+	average(sum [3]float64, count int) T // Pixel of the channel sums divided by the count
+	mix(other T, t float64) T            // Interpolates towards the other pixel (t = 0 keeps this one)
+}
+
+func (p Pixel) channels() [3]float64 {
+	return [3]float64{float64(p.Red), float64(p.Green), float64(p.Blue)}
+}
+
+// Truncates the averages like integer division, as the 8-bit kernels always have
+func (Pixel) average(sum [3]float64, count int) Pixel {
+	return Pixel{Red: byte(int(sum[0]) / count), Green: byte(int(sum[1]) / count), Blue: byte(int(sum[2]) / count)}
+}
+
+func (p Pixel) mix(other Pixel, t float64) Pixel {
+	return mixPixels(p, other, t)
+}
+
+func (p LinearPixel) channels() [3]float64 {
+	return [3]float64{float64(p.Red), float64(p.Green), float64(p.Blue)}
+}
+
+func (LinearPixel) average(sum [3]float64, count int) LinearPixel {
+	n := float64(count)
+	return LinearPixel{Red: float32(sum[0] / n), Green: float32(sum[1] / n), Blue: float32(sum[2] / n)}
+}
+
+func (p LinearPixel) mix(other LinearPixel, t float64) LinearPixel {
+	w := float32(t)
+	return LinearPixel{
+		Blue:  p.Blue + (other.Blue-p.Blue)*w,
+		Green: p.Green + (other.Green-p.Green)*w,
+		Red:   p.Red + (other.Red-p.Red)*w,
+	}
+}
+
+// Reports whether the filter has a linear-light implementation. Other filters run on 8-bit pixels
+func IsLinearFilter(filterType string) bool {
+	filterType, rawParams, _ := strings.Cut(filterType, ":")
+	switch filterType {
+	case "blue", "red", "green", "negative", "blur":
+		return true
+	case "grayscale":
+		return rawParams == "" // Luma methods other than the default are defined on encoded values
+	case "pixelate":
+		params := parseFilterParams(filterType, rawParams, "size", "style", "background", "region", "mask")
+		return params.String("style", "square") == "square" && params.Err() == nil
+	}
+	return false
+}
+
+// Applies filters to the linear-light buffer. Averaging filters (blur, pixelate) mix light
+// instead of encoded values, so edges and small highlights keep their brightness. Parameters,
+// regions and masks are the same as for the 8-bit filters
+func ApplyFilterLinear(pixels []LinearPixel, width, height int, filterType string) ([]LinearPixel, error) {
+	filterType, rawParams, _ := strings.Cut(filterType, ":")
+
+	switch filterType {
+	case "pixelate":
+		params := parseFilterParams(filterType, rawParams, "size", "style", "background", "region", "mask")
+		size := params.Int("size", 20, 2, 1024)
+		style := params.String("style", "square")
+		mask, err := filterMask(params, width, height)
+		if err := params.Err(); err != nil {
+			return nil, err
+		}
+		if err != nil {
+			return nil, err
+		}
+		if style != "square" {
+			return nil, fmt.Errorf("pixelation style '%s' is not supported in linear mode", style)
+		}
+		return ApplyMasked(pixels, width, height, mask, func(pixels []LinearPixel, width, height int) ([]LinearPixel, error) {
+			return applyPixelation(pixels, width, height, size), nil
+		})
+	case "blur":
+		params := parseFilterParams(filterType, rawParams, "size", "region", "mask")
+		size := params.Int("size", 25, 1, 255)
+		mask, err := filterMask(params, width, height)
+		if err := params.Err(); err != nil {
+			return nil, err
+		}
+		if err != nil {
+			return nil, err
+		}
+		return ApplyMasked(pixels, width, height, mask, func(pixels []LinearPixel, width, height int) ([]LinearPixel, error) {
+			return applyBlur(pixels, width, height, size), nil
+		})
+	}
+
+	// The remaining filters take no parameters
+	if err := parseFilterParams(filterType, rawParams).Err(); err != nil {
+		return nil, err
+	}
+
+	switch filterType {
+	case "blue":
+		for i := range pixels {
+			pixels[i].Red = 0
+			pixels[i].Green = 0
+		}
+	case "red":
+		for i := range pixels {
+			pixels[i].Green = 0
+			pixels[i].Blue = 0
+		}
+	case "green":
+		for i := range pixels {
+			pixels[i].Red = 0
+			pixels[i].Blue = 0
+		}
+	case "grayscale":
+		// Relative luminance of linear sRGB (BT.709 primaries)
+		for i := range pixels {
+			gray := 0.2126*pixels[i].Red + 0.7152*pixels[i].Green + 0.0722*pixels[i].Blue
+			pixels[i].Red, pixels[i].Green, pixels[i].Blue = gray, gray, gray
+		}
+	case "negative":
+		// Inverts the encoded values (as the 8-bit filter does) without losing precision
+		invert := func(v float32) float32 {
+			return float32(srgbToLinear(1 - linearToSRGB(float64(v))))
+		}
+		for i := range pixels {
+			pixels[i].Red = invert(pixels[i].Red)
+			pixels[i].Green = invert(pixels[i].Green)
+			pixels[i].Blue = invert(pixels[i].Blue)
+		}
+	default:
+		return nil, fmt.Errorf("filter '%s' is not supported in linear mode", filterType)
+	}
+	return pixels, nil
+}
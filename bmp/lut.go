@@ -0,0 +1,337 @@
+package bmp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Represents a 1D or 3D color lookup table as described by the Adobe/Resolve .cube format
+type LUT struct {
+	Title     string
+	Size      int          // Number of entries per channel
+	Is3D      bool         // 3D tables map colors as a whole, 1D tables map each channel separately
+	DomainMin [3]float64   // Input value mapped to the first entry (per channel, RGB order)
+	DomainMax [3]float64   // Input value mapped to the last entry (per channel, RGB order)
+	Table     [][3]float64 // Output RGB values. For 3D tables red changes fastest, then green, then blue
+}
+
+// Reads a .cube file (1D or 3D) into a lookup table
+func ReadCube(filename string) (*LUT, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error opening LUT file - %v", err)
+	}
+	defer file.Close()
+
+	lut := &LUT{DomainMax: [3]float64{1, 1, 1}}
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		switch fields[0] {
+		case "TITLE":
+			lut.Title = strings.Trim(strings.TrimSpace(strings.TrimPrefix(line, "TITLE")), "\"")
+		case "LUT_1D_SIZE", "LUT_3D_SIZE":
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("%s:%d: invalid %s line", filename, lineNumber, fields[0])
+			}
+			size, err := strconv.Atoi(fields[1])
+			if err != nil || size < 2 {
+				return nil, fmt.Errorf("%s:%d: invalid LUT size '%s'", filename, lineNumber, fields[1])
+			}
+			lut.Size = size
+			lut.Is3D = fields[0] == "LUT_3D_SIZE"
+		case "DOMAIN_MIN", "DOMAIN_MAX":
+			values, err := parseCubeTriplet(fields[1:])
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", filename, lineNumber, err)
+			}
+			if fields[0] == "DOMAIN_MIN" {
+				lut.DomainMin = values
+			} else {
+				lut.DomainMax = values
+			}
+		case "LUT_1D_INPUT_RANGE", "LUT_3D_INPUT_RANGE":
+			// Resolve-specific form of the domain with the same bounds for every channel
+			if len(fields) != 3 {
+				return nil, fmt.Errorf("%s:%d: invalid %s line", filename, lineNumber, fields[0])
+			}
+			low, errLow := strconv.ParseFloat(fields[1], 64)
+			high, errHigh := strconv.ParseFloat(fields[2], 64)
+			if errLow != nil || errHigh != nil {
+				return nil, fmt.Errorf("%s:%d: invalid input range", filename, lineNumber)
+			}
+			lut.DomainMin = [3]float64{low, low, low}
+			lut.DomainMax = [3]float64{high, high, high}
+		default:
+			if fields[0][0] >= 'A' && fields[0][0] <= 'Z' {
+				continue // Keywords of other tools (e.g. LUT_IN_VIDEO_RANGE) are ignored
+			}
+			values, err := parseCubeTriplet(fields)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", filename, lineNumber, err)
+			}
+			lut.Table = append(lut.Table, values)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading LUT file - %v", err)
+	}
+
+	if err := lut.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+
+	return lut, nil
+}
+
+// Writes the lookup table to a .cube file
+func WriteCube(filename string, lut *LUT) error {
+	if err := lut.validate(); err != nil {
+		return err
+	}
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("error creating LUT file - %v", err)
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	if lut.Title != "" {
+		fmt.Fprintf(writer, "TITLE \"%s\"\n", lut.Title)
+	}
+	if lut.Is3D {
+		fmt.Fprintf(writer, "LUT_3D_SIZE %d\n", lut.Size)
+	} else {
+		fmt.Fprintf(writer, "LUT_1D_SIZE %d\n", lut.Size)
+	}
+	fmt.Fprintf(writer, "DOMAIN_MIN %g %g %g\n", lut.DomainMin[0], lut.DomainMin[1], lut.DomainMin[2])
+	fmt.Fprintf(writer, "DOMAIN_MAX %g %g %g\n", lut.DomainMax[0], lut.DomainMax[1], lut.DomainMax[2])
+	for _, entry := range lut.Table {
+		fmt.Fprintf(writer, "%.6f %.6f %.6f\n", entry[0], entry[1], entry[2])
+	}
+
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("error writing LUT file - %v", err)
+	}
+	return nil
+}
+
+// Reads the lookup table of a --lut value of the form "<file.cube>[:trilinear|tetrahedral]".
+// Returns the table and the interpolation used for 3D tables
+func LoadLUT(value string) (*LUT, string, error) {
+	filename, interpolation := value, "trilinear"
+	if idx := strings.LastIndex(value, ":"); idx != -1 {
+		switch value[idx+1:] {
+		case "trilinear", "tetrahedral":
+			filename, interpolation = value[:idx], value[idx+1:]
+		}
+	}
+	if filename == "" {
+		return nil, "", errors.New("missing LUT file name")
+	}
+
+	lut, err := ReadCube(filename)
+	if err != nil {
+		return nil, "", err
+	}
+	return lut, interpolation, nil
+}
+
+// Applies the lookup table to every pixel. 3D tables use trilinear or tetrahedral interpolation
+func ApplyLUT(pixels []Pixel, width, height int, lut *LUT, interpolation string) []Pixel {
+	for i := range pixels {
+		rgb := [3]float64{float64(pixels[i].Red) / 255, float64(pixels[i].Green) / 255, float64(pixels[i].Blue) / 255}
+		switch {
+		case !lut.Is3D:
+			rgb = lut.lookup1D(rgb)
+		case interpolation == "tetrahedral":
+			rgb = lut.lookupTetrahedral(rgb)
+		default:
+			rgb = lut.lookupTrilinear(rgb)
+		}
+		pixels[i] = Pixel{Red: clampByte(rgb[0] * 255), Green: clampByte(rgb[1] * 255), Blue: clampByte(rgb[2] * 255)}
+	}
+
+	return pixels
+}
+
+// Generates an identity HALD image of the given level. The image is level^3 pixels wide and high
+// and contains every entry of a level^2 sized 3D LUT, red changing fastest
+func GenerateHald(level int) ([]Pixel, int, error) {
+	if level < 2 || level > 16 {
+		return nil, 0, fmt.Errorf("HALD level must be between 2 and 16, got %d", level)
+	}
+
+	cubeSize := level * level
+	side := cubeSize * level
+	pixels := make([]Pixel, side*side)
+
+	for i := range pixels {
+		r := i % cubeSize
+		g := (i / cubeSize) % cubeSize
+		b := i / (cubeSize * cubeSize)
+		pixels[i] = Pixel{
+			Red:   clampByte(float64(r) * 255 / float64(cubeSize-1)),
+			Green: clampByte(float64(g) * 255 / float64(cubeSize-1)),
+			Blue:  clampByte(float64(b) * 255 / float64(cubeSize-1)),
+		}
+	}
+
+	return pixels, side, nil
+}
+
+// Converts a (graded) HALD image back to a 3D lookup table
+func HaldToLUT(pixels []Pixel, width, height int) (*LUT, error) {
+	if width != height {
+		return nil, fmt.Errorf("HALD image must be square, got %dx%d", width, height)
+	}
+
+	level := int(math.Round(math.Cbrt(float64(width))))
+	if level < 2 || level*level*level != width {
+		return nil, fmt.Errorf("%dx%d is not a valid HALD image size", width, height)
+	}
+
+	cubeSize := level * level
+	lut := &LUT{Size: cubeSize, Is3D: true, DomainMax: [3]float64{1, 1, 1}, Table: make([][3]float64, len(pixels))}
+	for i, p := range pixels {
+		lut.Table[i] = [3]float64{float64(p.Red) / 255, float64(p.Green) / 255, float64(p.Blue) / 255}
+	}
+
+	return lut, nil
+}
+
+// Checks that the table contains exactly as many entries as its size requires
+func (lut *LUT) validate() error {
+	if lut.Size == 0 {
+		return errors.New("LUT size is not specified")
+	}
+
+	expected := lut.Size
+	if lut.Is3D {
+		expected = lut.Size * lut.Size * lut.Size
+	}
+	if len(lut.Table) != expected {
+		return fmt.Errorf("LUT has %d entries, expected %d", len(lut.Table), expected)
+	}
+
+	for c := 0; c < 3; c++ {
+		if lut.DomainMax[c] <= lut.DomainMin[c] {
+			return errors.New("LUT domain maximum must be greater than its minimum")
+		}
+	}
+
+	return nil
+}
+
+// Converts a normalized channel value into a (fractional) table coordinate
+func (lut *LUT) coordinate(v float64, channel int) float64 {
+	position := (v - lut.DomainMin[channel]) / (lut.DomainMax[channel] - lut.DomainMin[channel])
+	return clampFloat(position, 0, 1) * float64(lut.Size-1)
+}
+
+// Splits a table coordinate into the lower index and the interpolation weight
+func (lut *LUT) split(coordinate float64) (int, float64) {
+	index := int(coordinate)
+	if index >= lut.Size-1 {
+		index = lut.Size - 2
+	}
+	return index, coordinate - float64(index)
+}
+
+func (lut *LUT) at(r, g, b int) [3]float64 {
+	return lut.Table[r+g*lut.Size+b*lut.Size*lut.Size]
+}
+
+// Maps each channel through its own 1D curve with linear interpolation
+func (lut *LUT) lookup1D(rgb [3]float64) [3]float64 {
+	var result [3]float64
+	for c := 0; c < 3; c++ {
+		index, weight := lut.split(lut.coordinate(rgb[c], c))
+		result[c] = lut.Table[index][c]*(1-weight) + lut.Table[index+1][c]*weight
+	}
+	return result
+}
+
+// Interpolates between the eight corners of the lattice cell containing the color
+func (lut *LUT) lookupTrilinear(rgb [3]float64) [3]float64 {
+	r, fr := lut.split(lut.coordinate(rgb[0], 0))
+	g, fg := lut.split(lut.coordinate(rgb[1], 1))
+	b, fb := lut.split(lut.coordinate(rgb[2], 2))
+
+	var result [3]float64
+	for c := 0; c < 3; c++ {
+		c00 := lut.at(r, g, b)[c]*(1-fr) + lut.at(r+1, g, b)[c]*fr
+		c10 := lut.at(r, g+1, b)[c]*(1-fr) + lut.at(r+1, g+1, b)[c]*fr
+		c01 := lut.at(r, g, b+1)[c]*(1-fr) + lut.at(r+1, g, b+1)[c]*fr
+		c11 := lut.at(r, g+1, b+1)[c]*(1-fr) + lut.at(r+1, g+1, b+1)[c]*fr
+
+		c0 := c00*(1-fg) + c10*fg
+		c1 := c01*(1-fg) + c11*fg
+		result[c] = c0*(1-fb) + c1*fb
+	}
+	return result
+}
+
+// Interpolates inside one of the six tetrahedra the lattice cell is split into,
+// which uses only four corners and keeps the neutral axis exact
+func (lut *LUT) lookupTetrahedral(rgb [3]float64) [3]float64 {
+	r, fr := lut.split(lut.coordinate(rgb[0], 0))
+	g, fg := lut.split(lut.coordinate(rgb[1], 1))
+	b, fb := lut.split(lut.coordinate(rgb[2], 2))
+
+	c000, c111 := lut.at(r, g, b), lut.at(r+1, g+1, b+1)
+	var result [3]float64
+
+	for c := 0; c < 3; c++ {
+		switch {
+		case fr >= fg && fg >= fb:
+			c100, c110 := lut.at(r+1, g, b)[c], lut.at(r+1, g+1, b)[c]
+			result[c] = c000[c] + fr*(c100-c000[c]) + fg*(c110-c100) + fb*(c111[c]-c110)
+		case fr >= fb && fb >= fg:
+			c100, c101 := lut.at(r+1, g, b)[c], lut.at(r+1, g, b+1)[c]
+			result[c] = c000[c] + fr*(c100-c000[c]) + fb*(c101-c100) + fg*(c111[c]-c101)
+		case fb >= fr && fr >= fg:
+			c001, c101 := lut.at(r, g, b+1)[c], lut.at(r+1, g, b+1)[c]
+			result[c] = c000[c] + fb*(c001-c000[c]) + fr*(c101-c001) + fg*(c111[c]-c101)
+		case fb >= fg && fg >= fr:
+			c001, c011 := lut.at(r, g, b+1)[c], lut.at(r, g+1, b+1)[c]
+			result[c] = c000[c] + fb*(c001-c000[c]) + fg*(c011-c001) + fr*(c111[c]-c011)
+		case fg >= fb && fb >= fr:
+			c010, c011 := lut.at(r, g+1, b)[c], lut.at(r, g+1, b+1)[c]
+			result[c] = c000[c] + fg*(c010-c000[c]) + fb*(c011-c010) + fr*(c111[c]-c011)
+		default: // fg >= fr >= fb
+			c010, c110 := lut.at(r, g+1, b)[c], lut.at(r+1, g+1, b)[c]
+			result[c] = c000[c] + fg*(c010-c000[c]) + fr*(c110-c010) + fb*(c111[c]-c110)
+		}
+	}
+	return result
+}
+
+func parseCubeTriplet(fields []string) ([3]float64, error) {
+	var values [3]float64
+	if len(fields) != 3 {
+		return values, fmt.Errorf("expected 3 values, got %d", len(fields))
+	}
+	for i, field := range fields {
+		v, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return values, fmt.Errorf("invalid value '%s'", field)
+		}
+		values[i] = v
+	}
+	return values, nil
+}
@@ -0,0 +1,153 @@
+package bmp
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Builds a 3D table of the given size that maps every lattice point through the function
+func testLUT3D(size int, mapping func(rgb [3]float64) [3]float64) *LUT {
+	lut := &LUT{Size: size, Is3D: true, DomainMax: [3]float64{1, 1, 1}}
+	for b := 0; b < size; b++ {
+		for g := 0; g < size; g++ {
+			for r := 0; r < size; r++ {
+				step := float64(size - 1)
+				lut.Table = append(lut.Table, mapping([3]float64{float64(r) / step, float64(g) / step, float64(b) / step}))
+			}
+		}
+	}
+	return lut
+}
+
+func closeTo(a, b [3]float64) bool {
+	for c := range a {
+		if math.Abs(a[c]-b[c]) > 1e-9 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestLUTLookups(t *testing.T) {
+	identity := func(rgb [3]float64) [3]float64 { return rgb }
+	invert := func(rgb [3]float64) [3]float64 { return [3]float64{1 - rgb[0], 1 - rgb[1], 1 - rgb[2]} }
+	swap := func(rgb [3]float64) [3]float64 { return [3]float64{rgb[2], rgb[1], rgb[0]} }
+	curve := &LUT{Size: 3, DomainMax: [3]float64{1, 1, 1}, Table: [][3]float64{{0, 0, 1}, {0.25, 0.5, 0.5}, {1, 1, 0}}}
+	shifted := testLUT3D(2, identity)
+	shifted.DomainMin, shifted.DomainMax = [3]float64{0.5, 0.5, 0.5}, [3]float64{1, 1, 1}
+
+	tests := []struct {
+		name   string
+		lut    *LUT
+		lookup func(lut *LUT, rgb [3]float64) [3]float64
+		input  [3]float64
+		want   [3]float64
+	}{
+		{"1D at a table entry", curve, (*LUT).lookup1D, [3]float64{0.5, 0.5, 0.5}, [3]float64{0.25, 0.5, 0.5}},
+		{"1D between entries", curve, (*LUT).lookup1D, [3]float64{0.25, 0.75, 1}, [3]float64{0.125, 0.75, 0}},
+		{"1D below the domain", curve, (*LUT).lookup1D, [3]float64{-1, -1, -1}, [3]float64{0, 0, 1}},
+		{"trilinear identity", testLUT3D(5, identity), (*LUT).lookupTrilinear, [3]float64{0.3, 0.6, 0.9}, [3]float64{0.3, 0.6, 0.9}},
+		{"tetrahedral identity", testLUT3D(5, identity), (*LUT).lookupTetrahedral, [3]float64{0.3, 0.6, 0.9}, [3]float64{0.3, 0.6, 0.9}},
+		{"trilinear inversion", testLUT3D(2, invert), (*LUT).lookupTrilinear, [3]float64{0.2, 0.5, 0.7}, [3]float64{0.8, 0.5, 0.3}},
+		{"tetrahedral inversion", testLUT3D(2, invert), (*LUT).lookupTetrahedral, [3]float64{0.7, 0.2, 0.5}, [3]float64{0.3, 0.8, 0.5}},
+		{"trilinear channel swap", testLUT3D(3, swap), (*LUT).lookupTrilinear, [3]float64{0.1, 0.4, 0.8}, [3]float64{0.8, 0.4, 0.1}},
+		{"tetrahedral channel swap", testLUT3D(3, swap), (*LUT).lookupTetrahedral, [3]float64{0.8, 0.1, 0.4}, [3]float64{0.4, 0.1, 0.8}},
+		{"trilinear at the last entry", testLUT3D(4, invert), (*LUT).lookupTrilinear, [3]float64{1, 1, 1}, [3]float64{0, 0, 0}},
+		{"domain maps onto the table", shifted, (*LUT).lookupTrilinear, [3]float64{0.75, 0.5, 0.25}, [3]float64{0.5, 0, 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.lookup(tt.lut, tt.input); !closeTo(got, tt.want) {
+				t.Errorf("lookup(%v) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadCube(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+		want    *LUT
+	}{
+		{
+			name:    "1D table with a title",
+			content: "TITLE \"curve\"\nLUT_1D_SIZE 2\n0 0 0\n1 1 1\n",
+			want:    &LUT{Title: "curve", Size: 2, DomainMax: [3]float64{1, 1, 1}, Table: [][3]float64{{0, 0, 0}, {1, 1, 1}}},
+		},
+		{
+			name:    "comments, domain and unknown keywords",
+			content: "# graded\nLUT_IN_VIDEO_RANGE\nLUT_1D_SIZE 2\nDOMAIN_MIN 0 0 0\nDOMAIN_MAX 2 2 2\nLUT_OUT_VIDEO_RANGE\n\n1 0 0\n0 1 0\n",
+			want:    &LUT{Size: 2, DomainMax: [3]float64{2, 2, 2}, Table: [][3]float64{{1, 0, 0}, {0, 1, 0}}},
+		},
+		{
+			name:    "Resolve input range",
+			content: "LUT_1D_SIZE 2\nLUT_1D_INPUT_RANGE 0.1 0.9\n0 0 0\n1 1 1\n",
+			want:    &LUT{Size: 2, DomainMin: [3]float64{0.1, 0.1, 0.1}, DomainMax: [3]float64{0.9, 0.9, 0.9}, Table: [][3]float64{{0, 0, 0}, {1, 1, 1}}},
+		},
+		{name: "missing size", content: "0 0 0\n1 1 1\n", wantErr: true},
+		{name: "too few entries", content: "LUT_3D_SIZE 2\n0 0 0\n1 1 1\n", wantErr: true},
+		{name: "malformed entry", content: "LUT_1D_SIZE 2\n0 0\n1 1 1\n", wantErr: true},
+		{name: "lowercase garbage", content: "LUT_1D_SIZE 2\nfoo 0 0\n1 1 1\n", wantErr: true},
+		{name: "empty domain", content: "LUT_1D_SIZE 2\nDOMAIN_MIN 1 1 1\n0 0 0\n1 1 1\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "test.cube")
+			if err := os.WriteFile(filename, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			lut, err := ReadCube(filename)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("ReadCube succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadCube failed: %v", err)
+			}
+			if lut.Title != tt.want.Title || lut.Size != tt.want.Size || lut.Is3D != tt.want.Is3D ||
+				lut.DomainMin != tt.want.DomainMin || lut.DomainMax != tt.want.DomainMax {
+				t.Errorf("ReadCube = %+v, want %+v", lut, tt.want)
+			}
+			if len(lut.Table) != len(tt.want.Table) {
+				t.Fatalf("table has %d entries, want %d", len(lut.Table), len(tt.want.Table))
+			}
+			for i := range lut.Table {
+				if lut.Table[i] != tt.want.Table[i] {
+					t.Errorf("entry %d = %v, want %v", i, lut.Table[i], tt.want.Table[i])
+				}
+			}
+		})
+	}
+}
+
+func TestWriteCubeRoundTrip(t *testing.T) {
+	lut := testLUT3D(3, func(rgb [3]float64) [3]float64 { return [3]float64{rgb[1], rgb[2] * 0.5, 1 - rgb[0]} })
+	lut.Title = "round trip"
+
+	filename := filepath.Join(t.TempDir(), "test.cube")
+	if err := WriteCube(filename, lut); err != nil {
+		t.Fatalf("WriteCube failed: %v", err)
+	}
+	read, err := ReadCube(filename)
+	if err != nil {
+		t.Fatalf("ReadCube failed: %v", err)
+	}
+
+	if read.Title != lut.Title || read.Size != lut.Size || !read.Is3D {
+		t.Fatalf("ReadCube = %+v, want %+v", read, lut)
+	}
+	for i := range lut.Table {
+		if !closeTo(read.Table[i], lut.Table[i]) {
+			t.Errorf("entry %d = %v, want %v", i, read.Table[i], lut.Table[i])
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package bmp
+
+import "math"
+
+// Rounds the value and clamps it to the 0-255 range of a color channel
+func clampByte(v float64) byte {
+	if v <= 0 || math.IsNaN(v) {
+		return 0
+	}
+	if v >= 255 {
+		return 255
+	}
+	return byte(v + 0.5)
+}
+
+// Clamps an integer to the [low, high] range
+func clampInt(v, low, high int) int {
+	if v < low {
+		return low
+	}
+	if v > high {
+		return high
+	}
+	return v
+}
+
+// Clamps a float to the [low, high] range
+func clampFloat(v, low, high float64) float64 {
+	if v < low {
+		return low
+	}
+	if v > high {
+		return high
+	}
+	return v
+}
@@ -1,36 +1,12 @@
 package bmp
 
-import (
-	"fmt"
-)
-
-// Applies horizontal or vertical mirroring
-func ApplyMirror(pixels []Pixel, width, height int, mode string) ([]Pixel, error) {
-	mirror := make([]Pixel, len(pixels))
-
-	switch mode {
-	case "horizontal", "h", "horizontally", "hor":
-		// Iterate over each pixel in the bitmap
-		for y := 0; y < height; y++ {
-			for x := 0; x < width; x++ {
-				srcIndex := y*width + x               // Original pixel position
-				dstIndex := y*width + (width - 1 - x) // Mirrored position in the same row
-
-				mirror[dstIndex] = pixels[srcIndex]
-			}
-		}
-	case "vertical", "v", "vertically", "ver":
-		// Iterate over each pixel in the bitmap
-		for y := 0; y < height; y++ {
-			for x := 0; x < width; x++ {
-				srcIndex := y*width + x            // Original pixel position
-				dstIndex := (height-1-y)*width + x // Mirrored position in the opposite row
-
-				mirror[dstIndex] = pixels[srcIndex]
-			}
-		}
-	default:
-		return nil, fmt.Errorf("invalid mirror mode - '%s'", mode)
+// Applies horizontal or vertical mirroring to 8-bit or linear-light pixels
+func ApplyMirror[T any](pixels []T, width, height int, mode string) ([]T, error) {
+	orientation, err := ParseOrientation("--mirror", mode)
+	if err != nil {
+		return nil, err
 	}
+
+	mirror, _, _ := ApplyOrientation(pixels, width, height, orientation)
 	return mirror, nil
 }
@@ -0,0 +1,120 @@
+package bmp
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Height of the band under every tile that holds its caption
+const captionHeight = glyphHeight + 6
+
+// Lays the images out in a grid and returns the sheet with its size. The options are --tile=<W>x<H>
+// (the box every image is scaled to fit into, default 160x120), --columns=<n> (default a nearly
+// square grid), --spacing=<px> (gap between and around the tiles, default 10), --background=<color>
+// (default white) and --captions, which writes the file name under every tile
+func Montage(filenames []string, options []Option) ([]Pixel, int, int, error) {
+	tileWidth, tileHeight := 160, 120
+	columns, spacing := 0, 10
+	background := Pixel{Red: 255, Green: 255, Blue: 255}
+	captions := false
+
+	for _, opt := range options {
+		var err error
+		switch opt.Name {
+		case "--tile":
+			widthValue, heightValue, found := strings.Cut(opt.Value, "x")
+			var errWidth, errHeight error
+			tileWidth, errWidth = strconv.Atoi(widthValue)
+			tileHeight, errHeight = strconv.Atoi(heightValue)
+			if !found || errWidth != nil || errHeight != nil || tileWidth < 1 || tileHeight < 1 {
+				return nil, 0, 0, fmt.Errorf("invalid tile size - '%s'", opt.Value)
+			}
+		case "--columns":
+			columns, err = strconv.Atoi(opt.Value)
+			if err != nil || columns < 1 {
+				return nil, 0, 0, fmt.Errorf("invalid number of columns - '%s'", opt.Value)
+			}
+		case "--spacing":
+			spacing, err = strconv.Atoi(opt.Value)
+			if err != nil || spacing < 0 {
+				return nil, 0, 0, fmt.Errorf("invalid spacing - '%s'", opt.Value)
+			}
+		case "--background":
+			background, err = ParseColor(opt.Value)
+			if err != nil {
+				return nil, 0, 0, err
+			}
+		case "--captions":
+			captions = true
+		default:
+			return nil, 0, 0, fmt.Errorf("undefined option - %s", opt.Name)
+		}
+	}
+
+	if columns == 0 {
+		columns = int(math.Ceil(math.Sqrt(float64(len(filenames)))))
+	}
+	columns = min(columns, len(filenames))
+	rows := (len(filenames) + columns - 1) / columns
+
+	cellHeight := tileHeight
+	if captions {
+		cellHeight += captionHeight
+	}
+	width := columns*tileWidth + (columns+1)*spacing
+	height := rows*cellHeight + (rows+1)*spacing
+	if width > 65536 || height > 65536 || width*height > 1<<28 {
+		return nil, 0, 0, fmt.Errorf("montage size %dx%d is not supported", width, height)
+	}
+
+	sheet := make([]Pixel, width*height)
+	for i := range sheet {
+		sheet[i] = background
+	}
+
+	// Captions are black or white, whichever stands out more against the background
+	captionColor := Pixel{}
+	if lumaPlane([]Pixel{background})[0] < 128 {
+		captionColor = Pixel{Red: 255, Green: 255, Blue: 255}
+	}
+
+	// Images are read one at a time, so only the sheet is kept in memory
+	for i, filename := range filenames {
+		pixels, alpha, dibHeader, err := ReadImage(filename)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+
+		// Transparent images are flattened onto the background before scaling
+		for j := range alpha {
+			pixels[j] = mixPixels(background, pixels[j], alpha[j])
+		}
+
+		// Scale the image to fit the tile, keeping its aspect ratio
+		imageWidth, imageHeight := int(dibHeader.Width), int(dibHeader.Height)
+		scale := math.Min(float64(tileWidth)/float64(imageWidth), float64(tileHeight)/float64(imageHeight))
+		scaledWidth := max(1, int(math.Round(float64(imageWidth)*scale)))
+		scaledHeight := max(1, int(math.Round(float64(imageHeight)*scale)))
+		pixels = resize(pixels, imageWidth, imageHeight, scaledWidth, scaledHeight)
+
+		// Center the image in its tile
+		tileX := spacing + (i%columns)*(tileWidth+spacing)
+		tileY := spacing + (i/columns)*(cellHeight+spacing)
+		offsetX := tileX + (tileWidth-scaledWidth)/2
+		offsetY := tileY + (tileHeight-scaledHeight)/2
+		for y := 0; y < scaledHeight; y++ {
+			copy(sheet[(offsetY+y)*width+offsetX:], pixels[y*scaledWidth:(y+1)*scaledWidth])
+		}
+
+		if captions {
+			caption := fitText(filepath.Base(filename), tileWidth)
+			captionX := tileX + (tileWidth-textWidth(caption))/2
+			drawText(sheet, width, height, captionX, tileY+tileHeight+(captionHeight-glyphHeight)/2, caption, captionColor)
+		}
+	}
+
+	return sheet, width, height, nil
+}
@@ -0,0 +1,143 @@
+package bmp
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Represents a structuring element as the offsets of its active cells relative to its center
+type structuringElement [][2]int
+
+// Builds a structuring element of the given shape (square, cross or disk) and odd size,
+// or from a custom pattern of 0/1 rows separated by "-" (e.g. "010-111-010")
+func newStructuringElement(shape string, size int, pattern string) (structuringElement, error) {
+	if pattern != "" {
+		rows := strings.Split(pattern, "-")
+		if len(rows)%2 == 0 || len(rows[0])%2 == 0 {
+			return nil, fmt.Errorf("structuring element '%s' must have odd dimensions", pattern)
+		}
+
+		var element structuringElement
+		cy, cx := len(rows)/2, len(rows[0])/2
+		for y, row := range rows {
+			if len(row) != len(rows[0]) {
+				return nil, fmt.Errorf("structuring element '%s' has rows of different lengths", pattern)
+			}
+			for x, cell := range row {
+				switch cell {
+				case '1':
+					element = append(element, [2]int{x - cx, y - cy})
+				case '0':
+				default:
+					return nil, fmt.Errorf("structuring element '%s' may only contain 0 and 1", pattern)
+				}
+			}
+		}
+		if len(element) == 0 {
+			return nil, fmt.Errorf("structuring element '%s' has no active cells", pattern)
+		}
+		return element, nil
+	}
+
+	if size%2 == 0 {
+		return nil, fmt.Errorf("structuring element size must be odd, got %d", size)
+	}
+
+	var element structuringElement
+	radius := size / 2
+	for dy := -radius; dy <= radius; dy++ {
+		for dx := -radius; dx <= radius; dx++ {
+			var active bool
+			switch shape {
+			case "square":
+				active = true
+			case "cross":
+				active = dx == 0 || dy == 0
+			case "disk":
+				active = dx*dx+dy*dy <= radius*radius+radius // Slightly inflated so small disks are not crosses
+			default:
+				return nil, fmt.Errorf("invalid structuring element shape - '%s'", shape)
+			}
+			if active {
+				element = append(element, [2]int{dx, dy})
+			}
+		}
+	}
+	return element, nil
+}
+
+// Takes the per-channel minimum (erosion) or maximum (dilation) over the structuring element.
+// Dilation uses the reflected element, so openings and closings with asymmetric elements do not
+// shift the image. Binary images stay binary, grayscale and color images get grayscale morphology
+func morphologyPass(pixels []Pixel, width, height int, element structuringElement, dilate bool) []Pixel {
+	result := make([]Pixel, len(pixels))
+	direction := 1
+	if dilate {
+		direction = -1
+	}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var r, g, b byte
+			if !dilate {
+				r, g, b = 255, 255, 255
+			}
+
+			for _, offset := range element {
+				nx, ny := x+direction*offset[0], y+direction*offset[1]
+				if nx < 0 || nx >= width || ny < 0 || ny >= height {
+					continue // Pixels outside of the image do not take part
+				}
+				p := pixels[ny*width+nx]
+				if dilate {
+					r, g, b = max(r, p.Red), max(g, p.Green), max(b, p.Blue)
+				} else {
+					r, g, b = min(r, p.Red), min(g, p.Green), min(b, p.Blue)
+				}
+			}
+
+			result[y*width+x] = Pixel{Red: r, Green: g, Blue: b}
+		}
+	}
+	return result
+}
+
+// Subtracts b from a per channel, saturating at 0
+func subtractPixels(a, b []Pixel) []Pixel {
+	result := make([]Pixel, len(a))
+	for i := range a {
+		result[i] = Pixel{
+			Red:   a[i].Red - min(a[i].Red, b[i].Red),
+			Green: a[i].Green - min(a[i].Green, b[i].Green),
+			Blue:  a[i].Blue - min(a[i].Blue, b[i].Blue),
+		}
+	}
+	return result
+}
+
+// Applies a morphological operation: erode, dilate, open, close, tophat, blackhat or gradient
+func applyMorphology(pixels []Pixel, width, height int, operation string, element structuringElement) ([]Pixel, error) {
+	erode := func(p []Pixel) []Pixel { return morphologyPass(p, width, height, element, false) }
+	dilate := func(p []Pixel) []Pixel { return morphologyPass(p, width, height, element, true) }
+
+	switch operation {
+	case "erode":
+		return erode(pixels), nil
+	case "dilate":
+		return dilate(pixels), nil
+	case "open":
+		return dilate(erode(pixels)), nil
+	case "close":
+		return erode(dilate(pixels)), nil
+	case "tophat":
+		// Bright details smaller than the structuring element
+		return subtractPixels(pixels, dilate(erode(pixels))), nil
+	case "blackhat":
+		// Dark details smaller than the structuring element
+		return subtractPixels(erode(dilate(pixels)), pixels), nil
+	case "gradient":
+		return subtractPixels(dilate(pixels), erode(pixels)), nil
+	default:
+		return nil, fmt.Errorf("invalid morphological operation - '%s'", operation)
+	}
+}
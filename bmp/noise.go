@@ -0,0 +1,88 @@
+package bmp
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// Adds random noise to the image. Gaussian noise uses amount as the standard deviation and uniform
+// noise as the maximum deviation (both in 0-255 units), salt-and-pepper noise turns the amount
+// fraction of pixels black or white. Mono noise changes all channels of a pixel by the same value.
+// The seed makes the noise reproducible
+func applyNoise(pixels []Pixel, noiseType string, amount float64, mono bool, seed int64) ([]Pixel, error) {
+	random := rand.New(rand.NewSource(seed))
+
+	var sample func() float64
+	switch noiseType {
+	case "gaussian":
+		sample = func() float64 { return random.NormFloat64() * amount }
+	case "uniform":
+		sample = func() float64 { return (random.Float64()*2 - 1) * amount }
+	case "salt-pepper":
+		if amount > 1 {
+			return nil, fmt.Errorf("salt-and-pepper amount must be between 0 and 1, got %g", amount)
+		}
+		for i := range pixels {
+			if random.Float64() < amount {
+				if random.Intn(2) == 0 {
+					pixels[i] = black
+				} else {
+					pixels[i] = white
+				}
+			}
+		}
+		return pixels, nil
+	default:
+		return nil, fmt.Errorf("invalid noise type - '%s'", noiseType)
+	}
+
+	for i, p := range pixels {
+		nr := sample()
+		ng, nb := nr, nr
+		if !mono {
+			ng, nb = sample(), sample()
+		}
+		pixels[i] = Pixel{
+			Red:   clampByte(float64(p.Red) + nr),
+			Green: clampByte(float64(p.Green) + ng),
+			Blue:  clampByte(float64(p.Blue) + nb),
+		}
+	}
+	return pixels, nil
+}
+
+// Simulates film grain: blurred (clumped) monochrome noise of the given grain size that is strongest
+// in the midtones and fades out in deep shadows and highlights
+func applyGrain(pixels []Pixel, width, height int, amount, size float64, seed int64) []Pixel {
+	random := rand.New(rand.NewSource(seed))
+
+	grain := make([]float64, len(pixels))
+	for i := range grain {
+		grain[i] = random.NormFloat64()
+	}
+	if size > 1 {
+		grain = gaussianBlurPlane(grain, width, height, size/2)
+
+		// Blurring lowers the deviation of the noise, restore it so the amount keeps its meaning
+		var variance float64
+		for _, g := range grain {
+			variance += g * g
+		}
+		deviation := math.Sqrt(variance / float64(len(grain)))
+		for i := range grain {
+			grain[i] /= deviation
+		}
+	}
+
+	for i, l := range lumaPlane(pixels) {
+		t := l / 255
+		offset := grain[i] * amount * 50 * 4 * t * (1 - t)
+		pixels[i] = Pixel{
+			Red:   clampByte(float64(pixels[i].Red) + offset),
+			Green: clampByte(float64(pixels[i].Green) + offset),
+			Blue:  clampByte(float64(pixels[i].Blue) + offset),
+		}
+	}
+	return pixels
+}
@@ -0,0 +1,127 @@
+package bmp
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Represents one of the eight EXIF orientations as the transform that turns an image stored
+// with that orientation upright. Any chain of rotations and mirrors is one of them
+type Orientation int
+
+const (
+	OrientNormal Orientation = iota + 1
+	OrientMirrorHorizontal
+	OrientRotate180
+	OrientMirrorVertical
+	OrientTranspose
+	OrientRotate90
+	OrientTransverse
+	OrientRotate270
+)
+
+// Maps centered source coordinates (x, y) to destination coordinates (xx*x + xy*y, yx*x + yy*y)
+var orientationMatrices = [...][4]int{
+	OrientNormal:           {1, 0, 0, 1},
+	OrientMirrorHorizontal: {-1, 0, 0, 1},
+	OrientRotate180:        {-1, 0, 0, -1},
+	OrientMirrorVertical:   {1, 0, 0, -1},
+	OrientTranspose:        {0, 1, 1, 0},
+	OrientRotate90:         {0, -1, 1, 0},
+	OrientTransverse:       {0, -1, -1, 0},
+	OrientRotate270:        {0, 1, -1, 0},
+}
+
+// Returns the orientation that applies o first and next after it
+func (o Orientation) Then(next Orientation) Orientation {
+	a, b := orientationMatrices[o], orientationMatrices[next]
+	product := [4]int{
+		b[0]*a[0] + b[1]*a[2], b[0]*a[1] + b[1]*a[3],
+		b[2]*a[0] + b[3]*a[2], b[2]*a[1] + b[3]*a[3],
+	}
+	for candidate := OrientNormal; candidate <= OrientRotate270; candidate++ {
+		if orientationMatrices[candidate] == product {
+			return candidate
+		}
+	}
+	panic("orientations are closed under composition")
+}
+
+// Reports whether the orientation swaps the width and the height
+func (o Orientation) SwapsAxes() bool {
+	return orientationMatrices[o][0] == 0
+}
+
+// Converts a --rotate, --mirror, --orient, --transpose or --transverse option into its orientation
+func ParseOrientation(name, value string) (Orientation, error) {
+	switch name {
+	case "--rotate":
+		angle, err := ParseRotationValue(value)
+		if err != nil {
+			return 0, err
+		}
+		return map[int]Orientation{90: OrientRotate90, 180: OrientRotate180, 270: OrientRotate270}[angle], nil
+	case "--mirror":
+		switch value {
+		case "horizontal", "h", "horizontally", "hor":
+			return OrientMirrorHorizontal, nil
+		case "vertical", "v", "vertically", "ver":
+			return OrientMirrorVertical, nil
+		default:
+			return 0, fmt.Errorf("invalid mirror mode - '%s'", value)
+		}
+	case "--orient":
+		orientation, err := strconv.Atoi(value)
+		if err != nil || orientation < 1 || orientation > 8 {
+			return 0, fmt.Errorf("orientation must be between 1 and 8, got '%s'", value)
+		}
+		return Orientation(orientation), nil
+	case "--transpose":
+		return OrientTranspose, nil
+	case "--transverse":
+		return OrientTransverse, nil
+	default:
+		return 0, fmt.Errorf("%s is not an orientation option", name)
+	}
+}
+
+// Reports whether the option only rotates or mirrors the image
+func IsOrientationOption(name string) bool {
+	switch name {
+	case "--rotate", "--mirror", "--orient", "--transpose", "--transverse":
+		return true
+	}
+	return false
+}
+
+// Remaps the image (8-bit or linear-light pixels) into the given orientation in a single pass
+// and returns it with its new size
+func ApplyOrientation[T any](pixels []T, width, height int, orientation Orientation) ([]T, int, int) {
+	newWidth, newHeight := width, height
+	if orientation.SwapsAxes() {
+		newWidth, newHeight = height, width
+	}
+
+	remapped := make([]T, len(pixels))
+	for y := 0; y < newHeight; y++ {
+		for x := 0; x < newWidth; x++ {
+			sourceX, sourceY := orientationSource(orientation, width, height, x, y)
+			remapped[y*newWidth+x] = pixels[sourceY*width+sourceX]
+		}
+	}
+	return remapped, newWidth, newHeight
+}
+
+// Returns the source pixel that the orientation moves to the given pixel of its result
+func orientationSource(orientation Orientation, width, height, x, y int) (int, int) {
+	newWidth, newHeight := width, height
+	if orientation.SwapsAxes() {
+		newWidth, newHeight = height, width
+	}
+
+	// The matrix is orthogonal, so its transpose maps destination coordinates back to the source.
+	// Centered coordinates are doubled to stay integral
+	m := orientationMatrices[orientation]
+	dx, dy := 2*x+1-newWidth, 2*y+1-newHeight
+	return (m[0]*dx + m[2]*dy + width - 1) / 2, (m[1]*dx + m[3]*dy + height - 1) / 2
+}
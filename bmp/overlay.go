@@ -0,0 +1,145 @@
+package bmp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Represents an image drawn on top of another one. Pixels within the tolerance of the key color
+// are transparent, and the alpha channel of a 32-bit file (nil if opaque) is applied
+type overlayImage struct {
+	pixels        []Pixel
+	alpha         Mask
+	width, height int
+	key           *Pixel
+	tolerance     int
+}
+
+// Reads the overlay image from a 24-bit BMP file or a 32-bit BMP file with an alpha channel
+func readOverlay(filename string) (*overlayImage, error) {
+	pixels, alpha, dibHeader, err := ReadImage(filename)
+	if err != nil {
+		return nil, err
+	}
+	return &overlayImage{pixels: pixels, alpha: alpha, width: int(dibHeader.Width), height: int(dibHeader.Height)}, nil
+}
+
+// Blends the overlay into the image with its top left corner at (x, y). Parts outside of the image
+// and transparent pixels are skipped
+func (overlay *overlayImage) drawAt(pixels []Pixel, width, height, x, y int, opacity float64) {
+	for oy := max(0, -y); oy < overlay.height && y+oy < height; oy++ {
+		for ox := max(0, -x); ox < overlay.width && x+ox < width; ox++ {
+			p := overlay.pixels[oy*overlay.width+ox]
+			if overlay.key != nil && absDiff(p.Red, overlay.key.Red) <= overlay.tolerance &&
+				absDiff(p.Green, overlay.key.Green) <= overlay.tolerance && absDiff(p.Blue, overlay.key.Blue) <= overlay.tolerance {
+				continue
+			}
+			weight := opacity
+			if overlay.alpha != nil {
+				weight *= overlay.alpha[oy*overlay.width+ox]
+			}
+			idx := (y+oy)*width + x + ox
+			pixels[idx] = mixPixels(pixels[idx], p, weight)
+		}
+	}
+}
+
+// Draws another BMP image on top of this one. The value is "<file.bmp>[:<x>,<y>[:<opacity>[:<key>[,<tolerance>]]]]"
+// where x and y place the top left corner of the overlay (default 0,0), opacity is 0-1 (default 1)
+// and pixels of the key color (within the tolerance) are left transparent
+func ApplyOverlay(pixels []Pixel, width, height int, value string) ([]Pixel, error) {
+	parts := strings.SplitN(value, ":", 4)
+
+	overlay, err := readOverlay(parts[0])
+	if err != nil {
+		return nil, err
+	}
+
+	var x, y int
+	if len(parts) > 1 {
+		xValue, yValue, found := strings.Cut(parts[1], ",")
+		var errX, errY error
+		x, errX = strconv.Atoi(xValue)
+		y, errY = strconv.Atoi(yValue)
+		if !found || errX != nil || errY != nil {
+			return nil, fmt.Errorf("invalid overlay position - '%s'", parts[1])
+		}
+	}
+
+	opacity := 1.0
+	if len(parts) > 2 {
+		opacity, err = strconv.ParseFloat(parts[2], 64)
+		if err != nil || opacity < 0 || opacity > 1 {
+			return nil, fmt.Errorf("invalid overlay opacity - '%s'", parts[2])
+		}
+	}
+
+	if len(parts) > 3 {
+		keyValue, toleranceValue, found := strings.Cut(parts[3], ",")
+		key, err := ParseColor(keyValue)
+		if err != nil {
+			return nil, err
+		}
+		overlay.key = &key
+		if found {
+			overlay.tolerance, err = strconv.Atoi(toleranceValue)
+			if err != nil || overlay.tolerance < 0 || overlay.tolerance > 255 {
+				return nil, fmt.Errorf("invalid color key tolerance - '%s'", toleranceValue)
+			}
+		}
+	}
+
+	overlay.drawAt(pixels, width, height, x, y, opacity)
+	return pixels, nil
+}
+
+// Stamps a watermark image. The value is "<file.bmp>[:<params>]" with the parameters gravity (default
+// southeast), opacity (0-1, default 0.5), margin (distance from the edges in pixels, default 10),
+// tile (repeat the watermark over the whole image, spaced by the margin), key and tolerance
+func ApplyWatermark(pixels []Pixel, width, height int, value string) ([]Pixel, error) {
+	filename, rawParams, _ := strings.Cut(value, ":")
+
+	params := parseFilterParams("watermark", rawParams, "gravity", "opacity", "margin", "tile", "key", "tolerance")
+	gravity := params.String("gravity", "southeast")
+	opacity := params.Float("opacity", 0.5, 0, 1)
+	margin := params.Int("margin", 10, 0, 10000)
+	tile := params.Bool("tile", false)
+	key := params.Color("key", Pixel{})
+	tolerance := params.Int("tolerance", 0, 0, 255)
+	if err := params.Err(); err != nil {
+		return nil, err
+	}
+
+	anchor, ok := gravities[gravity]
+	if !ok {
+		return nil, fmt.Errorf("invalid watermark gravity - '%s'", gravity)
+	}
+
+	overlay, err := readOverlay(filename)
+	if err != nil {
+		return nil, err
+	}
+	if params.Has("key") {
+		overlay.key = &key
+		overlay.tolerance = tolerance
+	}
+
+	// The gravity places the first watermark, tiles continue from it in every direction
+	x := margin + int(float64(width-overlay.width-2*margin)*anchor[0])
+	y := margin + int(float64(height-overlay.height-2*margin)*anchor[1])
+	if !tile {
+		overlay.drawAt(pixels, width, height, x, y, opacity)
+		return pixels, nil
+	}
+
+	stepX, stepY := overlay.width+margin, overlay.height+margin
+	startX := x - max(x+overlay.width-1, 0)/stepX*stepX // Leftmost position that still touches the image
+	startY := y - max(y+overlay.height-1, 0)/stepY*stepY
+	for ty := startY; ty < height; ty += stepY {
+		for tx := startX; tx < width; tx += stepX {
+			overlay.drawAt(pixels, width, height, tx, ty, opacity)
+		}
+	}
+	return pixels, nil
+}
@@ -0,0 +1,35 @@
+package bmp
+
+// Palette used for 1-bit output
+var BlackAndWhitePalette = []Pixel{black, white}
+
+// Finds the index of the palette color closest to the pixel (squared RGB distance)
+func nearestColor(p Pixel, palette []Pixel) int {
+	best, bestDistance := 0, -1
+	for i, c := range palette {
+		dr := int(p.Red) - int(c.Red)
+		dg := int(p.Green) - int(c.Green)
+		db := int(p.Blue) - int(c.Blue)
+		distance := dr*dr + dg*dg + db*db
+		if bestDistance == -1 || distance < bestDistance {
+			best, bestDistance = i, distance
+		}
+	}
+	return best
+}
+
+// Maps every pixel to the index of its closest palette color
+func paletteIndices(pixels []Pixel, palette []Pixel) []byte {
+	indices := make([]byte, len(pixels))
+	cache := map[Pixel]byte{}
+
+	for i, p := range pixels {
+		index, ok := cache[p]
+		if !ok {
+			index = byte(nearestColor(p, palette))
+			cache[p] = index
+		}
+		indices[i] = index
+	}
+	return indices
+}
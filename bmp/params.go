@@ -0,0 +1,214 @@
+package bmp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Represents the parameters of a filter written as "<filter>:<param>,<param>,...".
+// Parameters are either positional or named ("key=value"). The first invalid value
+// is remembered and reported by Err, so lookups can be chained without checks
+type filterParams struct {
+	filter string
+	values map[string]string
+	err    error
+}
+
+// Parses the raw parameter list of a filter. Positional parameters are assigned to names in order
+func parseFilterParams(filter, raw string, names ...string) *filterParams {
+	params := &filterParams{filter: filter, values: map[string]string{}}
+	if raw == "" {
+		return params
+	}
+	if len(names) == 0 {
+		params.fail(fmt.Errorf("filter '%s' takes no parameters", filter))
+		return params
+	}
+
+	for i, part := range strings.Split(raw, ",") {
+		key, value, named := strings.Cut(part, "=")
+		if !named {
+			if i >= len(names) {
+				params.fail(fmt.Errorf("too many parameters for filter '%s'", filter))
+				break
+			}
+			key, value = names[i], part
+		}
+
+		known := false
+		for _, name := range names {
+			known = known || name == key
+		}
+		if !known {
+			params.fail(fmt.Errorf("unknown parameter '%s' for filter '%s'", key, filter))
+			break
+		}
+		params.values[key] = value
+	}
+
+	return params
+}
+
+func (p *filterParams) fail(err error) {
+	if p.err == nil {
+		p.err = err
+	}
+}
+
+// Returns the first error encountered while parsing or reading parameters
+func (p *filterParams) Err() error {
+	return p.err
+}
+
+// Reports whether the parameter was given
+func (p *filterParams) Has(name string) bool {
+	_, ok := p.values[name]
+	return ok
+}
+
+// Returns the parameter as a string or the default value if it is missing
+func (p *filterParams) String(name, def string) string {
+	if value, ok := p.values[name]; ok {
+		return value
+	}
+	return def
+}
+
+// Returns the parameter as a float within [low, high] or the default value if it is missing
+func (p *filterParams) Float(name string, def, low, high float64) float64 {
+	value, ok := p.values[name]
+	if !ok {
+		return def
+	}
+
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		p.fail(fmt.Errorf("invalid %s value for filter '%s' - '%s'", name, p.filter, value))
+		return def
+	}
+	if v < low || v > high {
+		p.fail(fmt.Errorf("%s for filter '%s' must be between %g and %g, got %g", name, p.filter, low, high, v))
+		return def
+	}
+	return v
+}
+
+// Returns the parameter as an integer within [low, high] or the default value if it is missing
+func (p *filterParams) Int(name string, def, low, high int) int {
+	value, ok := p.values[name]
+	if !ok {
+		return def
+	}
+
+	v, err := strconv.Atoi(value)
+	if err != nil {
+		p.fail(fmt.Errorf("invalid %s value for filter '%s' - '%s'", name, p.filter, value))
+		return def
+	}
+	if v < low || v > high {
+		p.fail(fmt.Errorf("%s for filter '%s' must be between %d and %d, got %d", name, p.filter, low, high, v))
+		return def
+	}
+	return v
+}
+
+// Returns the parameter as a color or the default value if it is missing
+func (p *filterParams) Color(name string, def Pixel) Pixel {
+	value, ok := p.values[name]
+	if !ok {
+		return def
+	}
+
+	color, err := ParseColor(value)
+	if err != nil {
+		p.fail(fmt.Errorf("invalid %s for filter '%s' - %v", name, p.filter, err))
+		return def
+	}
+	return color
+}
+
+// Returns the parameter as a list of colors separated by "-" (e.g. "000000-ffffff") or nil if it is missing
+func (p *filterParams) Palette(name string) []Pixel {
+	value, ok := p.values[name]
+	if !ok {
+		return nil
+	}
+
+	var palette []Pixel
+	for _, part := range strings.Split(value, "-") {
+		color, err := ParseColor(part)
+		if err != nil {
+			p.fail(fmt.Errorf("invalid %s for filter '%s' - %v", name, p.filter, err))
+			return nil
+		}
+		palette = append(palette, color)
+	}
+	if len(palette) > 256 {
+		p.fail(fmt.Errorf("%s for filter '%s' has more than 256 colors", name, p.filter))
+		return nil
+	}
+	return palette
+}
+
+// Returns the parameter as a boolean ("true"/"false", "yes"/"no", "on"/"off") or the default value if it is missing
+func (p *filterParams) Bool(name string, def bool) bool {
+	value, ok := p.values[name]
+	if !ok {
+		return def
+	}
+
+	switch strings.ToLower(value) {
+	case "true", "yes", "on", "1":
+		return true
+	case "false", "no", "off", "0":
+		return false
+	default:
+		p.fail(fmt.Errorf("invalid %s value for filter '%s' - '%s'", name, p.filter, value))
+		return def
+	}
+}
+
+// Returns an error if a required parameter is missing
+func (p *filterParams) Require(names ...string) {
+	for _, name := range names {
+		if !p.Has(name) {
+			p.fail(fmt.Errorf("filter '%s' requires the %s parameter", p.filter, name))
+		}
+	}
+}
+
+// Named colors accepted wherever a color is expected
+var namedColors = map[string]Pixel{
+	"black":   {Red: 0, Green: 0, Blue: 0},
+	"white":   {Red: 255, Green: 255, Blue: 255},
+	"gray":    {Red: 128, Green: 128, Blue: 128},
+	"red":     {Red: 255, Green: 0, Blue: 0},
+	"green":   {Red: 0, Green: 255, Blue: 0},
+	"blue":    {Red: 0, Green: 0, Blue: 255},
+	"yellow":  {Red: 255, Green: 255, Blue: 0},
+	"cyan":    {Red: 0, Green: 255, Blue: 255},
+	"magenta": {Red: 255, Green: 0, Blue: 255},
+}
+
+// Parses a color given as a name (e.g. "white") or as hex digits ("ff8000", "#ff8000" or "f80")
+func ParseColor(value string) (Pixel, error) {
+	if color, ok := namedColors[strings.ToLower(value)]; ok {
+		return color, nil
+	}
+
+	hex := strings.TrimPrefix(value, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) != 6 {
+		return Pixel{}, fmt.Errorf("'%s' is not a valid color", value)
+	}
+
+	rgb, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return Pixel{}, fmt.Errorf("'%s' is not a valid color", value)
+	}
+
+	return Pixel{Red: byte(rgb >> 16), Green: byte(rgb >> 8), Blue: byte(rgb)}, nil
+}
@@ -0,0 +1,335 @@
+package bmp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Represents a single step of the processing plan compiled from the ordered options
+type PlanStep struct {
+	Option
+	Region string // Value of the --region that limits the step, empty for the whole image
+	Note   string // Explains how the optimizer changed the step, empty for options kept as given
+}
+
+// Options that configure the run instead of processing the image
+var settingOptions = map[string]bool{
+	"--bits":     true,
+	"--quantize": true,
+	"--linear":   true,
+	"--explain":  true,
+}
+
+// Options that keep the image size and can therefore be limited to a --region
+var regionOptions = map[string]bool{
+	"--filter":    true,
+	"--channel":   true,
+	"--lut":       true,
+	"--overlay":   true,
+	"--watermark": true,
+}
+
+// Filters that change every pixel depending only on its own value, so they commute with crops
+var pointwiseFilters = map[string]bool{
+	"blue":      true,
+	"red":       true,
+	"green":     true,
+	"negative":  true,
+	"grayscale": true,
+	"sepia":     true,
+	"duotone":   true,
+	"colorize":  true,
+	"threshold": true,
+	"posterize": true,
+}
+
+// Compiles the ordered options into an optimized plan for an image of the given size: consecutive
+// rotations and mirrors are composed into one orientation, crops are moved before pointwise filters
+// and orientations, consecutive crops are merged, and steps that cancel out (two negatives, four right rotations) are removed
+func CompilePlan(options []Option, width, height int) ([]PlanStep, error) {
+	var plan []PlanStep
+	region := ""
+	for _, opt := range options {
+		if settingOptions[opt.Name] {
+			continue
+		}
+		if region != "" && !regionOptions[opt.Name] {
+			return nil, fmt.Errorf("--region can only be followed by --filter, --channel, --lut, --overlay or --watermark, got %s", opt.Name)
+		}
+		if region != "" && opt.Name == "--filter" && (strings.Contains(opt.Value, "region=") || strings.Contains(opt.Value, "mask=")) {
+			return nil, fmt.Errorf("--region cannot be combined with the region or mask parameter of a filter")
+		}
+		if opt.Name == "--region" {
+			if opt.Value == "" {
+				return nil, fmt.Errorf("invalid region - '%s'", opt.Value)
+			}
+			region = opt.Value
+			continue
+		}
+		plan = append(plan, PlanStep{Option: opt, Region: region})
+		region = ""
+	}
+	if region != "" {
+		return nil, fmt.Errorf("--region must be followed by the option it limits")
+	}
+
+	// Every pass may make further passes possible, so repeat until the plan stops changing
+	for changed := true; changed; {
+		var err error
+		changed = false
+		for _, pass := range []func([]PlanStep, int, int) ([]PlanStep, bool, error){fuseOrientations, cancelPairs, pushCrops, mergeCrops} {
+			var passChanged bool
+			plan, passChanged, err = pass(plan, width, height)
+			if err != nil {
+				return nil, err
+			}
+			changed = changed || passChanged
+		}
+	}
+	return plan, nil
+}
+
+// Formats the plan with one numbered step per line and the optimizer notes
+func ExplainPlan(plan []PlanStep) string {
+	var builder strings.Builder
+	builder.WriteString("Plan:\n")
+	if len(plan) == 0 {
+		builder.WriteString("  (no processing steps)\n")
+	}
+	for i, step := range plan {
+		line := step.Name
+		if step.Value != "" {
+			line += "=" + step.Value
+		}
+		if step.Region != "" {
+			line = "--region=" + step.Region + " " + line
+		}
+		if step.Note != "" {
+			line = fmt.Sprintf("%-40s (%s)", line, step.Note)
+		}
+		fmt.Fprintf(&builder, "  %d. %s\n", i+1, line)
+	}
+	return builder.String()
+}
+
+// Composes runs of consecutive orientation options into a single --orient step and drops the run
+// if it leaves the image as it is
+func fuseOrientations(plan []PlanStep, width, height int) ([]PlanStep, bool, error) {
+	var result []PlanStep
+	changed := false
+
+	for i := 0; i < len(plan); {
+		if !IsOrientationOption(plan[i].Name) {
+			result = append(result, plan[i])
+			i++
+			continue
+		}
+
+		orientation := OrientNormal
+		var fused []string
+		j := i
+		for ; j < len(plan) && IsOrientationOption(plan[j].Name); j++ {
+			next, err := ParseOrientation(plan[j].Name, plan[j].Value)
+			if err != nil {
+				return nil, false, err
+			}
+			orientation = orientation.Then(next)
+			fused = append(fused, optionString(plan[j]))
+		}
+
+		// A single --orient step that stays as it is does not count as a change
+		if j-i == 1 && plan[i].Name == "--orient" && orientation != OrientNormal {
+			result = append(result, plan[i])
+			i = j
+			continue
+		}
+
+		changed = true
+		if orientation != OrientNormal {
+			note := "fused " + strings.Join(fused, " ")
+			if j-i == 1 {
+				note = plan[i].Note
+				if note == "" {
+					note = "from " + fused[0]
+				}
+			}
+			result = append(result, PlanStep{Option: Option{Name: "--orient", Value: strconv.Itoa(int(orientation))}, Note: note})
+		}
+		i = j
+	}
+	return result, changed, nil
+}
+
+// Removes adjacent steps that undo each other
+func cancelPairs(plan []PlanStep, width, height int) ([]PlanStep, bool, error) {
+	var result []PlanStep
+	changed := false
+
+	for _, step := range plan {
+		if n := len(result); n > 0 && isNegative(step) && isNegative(result[n-1]) {
+			result = result[:n-1]
+			changed = true
+			continue
+		}
+		result = append(result, step)
+	}
+	return result, changed, nil
+}
+
+func isNegative(step PlanStep) bool {
+	return step.Name == "--filter" && step.Region == "" && (step.Value == "negative" || step.Value == "negative:")
+}
+
+// Moves crops before the preceding pointwise steps and orientations, so those steps process fewer pixels
+func pushCrops(plan []PlanStep, width, height int) ([]PlanStep, bool, error) {
+	changed := false
+
+	for i := 1; i < len(plan); i++ {
+		if plan[i].Name != "--crop" {
+			continue
+		}
+		previous := plan[i-1]
+
+		switch {
+		case isPointwise(previous):
+			crop := plan[i]
+			if crop.Note == "" {
+				crop.Note = "moved before " + optionString(previous)
+			}
+			plan[i-1], plan[i] = crop, previous
+			changed = true
+
+		case previous.Name == "--orient":
+			// Image size before the orientation is needed to translate the crop
+			w, h, known := planSize(plan[:i-1], width, height)
+			if !known {
+				continue
+			}
+			orientation, err := ParseOrientation(previous.Name, previous.Value)
+			if err != nil {
+				return nil, false, err
+			}
+			orientedWidth, orientedHeight := w, h
+			if orientation.SwapsAxes() {
+				orientedWidth, orientedHeight = h, w
+			}
+			x, y, cropWidth, cropHeight, ok := cropRectangle(plan[i].Value, orientedWidth, orientedHeight)
+			if !ok {
+				continue // Invalid crops are reported when they run
+			}
+
+			// Map two opposite corners of the crop back into the source
+			x0, y0 := orientationSource(orientation, w, h, x, y)
+			x1, y1 := orientationSource(orientation, w, h, x+cropWidth-1, y+cropHeight-1)
+			value := fmt.Sprintf("%d-%d-%d-%d", min(x0, x1), min(y0, y1), abs(x1-x0)+1, abs(y1-y0)+1)
+
+			crop := PlanStep{Option: Option{Name: "--crop", Value: value}, Note: "moved before " + optionString(previous) + " as " + optionString(plan[i])}
+			plan[i-1], plan[i] = crop, previous
+			changed = true
+		}
+	}
+	return plan, changed, nil
+}
+
+// Replaces consecutive crops with a single crop of the same area
+func mergeCrops(plan []PlanStep, width, height int) ([]PlanStep, bool, error) {
+	changed := false
+
+	for i := 1; i < len(plan); i++ {
+		if plan[i].Name != "--crop" || plan[i-1].Name != "--crop" {
+			continue
+		}
+		w, h, known := planSize(plan[:i-1], width, height)
+		if !known {
+			continue
+		}
+		x0, y0, firstWidth, firstHeight, ok := cropRectangle(plan[i-1].Value, w, h)
+		if !ok {
+			continue
+		}
+		x1, y1, secondWidth, secondHeight, ok := cropRectangle(plan[i].Value, firstWidth, firstHeight)
+		if !ok {
+			continue
+		}
+
+		merged := PlanStep{
+			Option: Option{Name: "--crop", Value: fmt.Sprintf("%d-%d-%d-%d", x0+x1, y0+y1, secondWidth, secondHeight)},
+			Note:   "merged " + optionString(plan[i-1]) + " " + optionString(plan[i]),
+		}
+		plan = append(plan[:i-1], append([]PlanStep{merged}, plan[i+1:]...)...)
+		changed = true
+		i--
+	}
+	return plan, changed, nil
+}
+
+// Reports whether the step changes every pixel on its own and keeps the image size
+func isPointwise(step PlanStep) bool {
+	if step.Region != "" {
+		return false // The region is given in the coordinates of the uncropped image
+	}
+	switch step.Name {
+	case "--channel", "--lut":
+		return true
+	case "--filter":
+		name, params, _ := strings.Cut(step.Value, ":")
+		return pointwiseFilters[name] && !strings.Contains(params, "region=") && !strings.Contains(params, "mask=")
+	}
+	return false
+}
+
+// Follows the image size through the plan as far as it can be known without running it
+func planSize(plan []PlanStep, width, height int) (int, int, bool) {
+	for _, step := range plan {
+		switch {
+		case step.Name == "--filter", step.Name == "--channel", step.Name == "--lut", step.Name == "--overlay", step.Name == "--watermark",
+			IsAlphaOption(step.Name):
+		case IsOrientationOption(step.Name):
+			orientation, err := ParseOrientation(step.Name, step.Value)
+			if err != nil {
+				return 0, 0, false
+			}
+			if orientation.SwapsAxes() {
+				width, height = height, width
+			}
+		case step.Name == "--crop":
+			var ok bool
+			_, _, width, height, ok = cropRectangle(step.Value, width, height)
+			if !ok {
+				return 0, 0, false
+			}
+		default:
+			return 0, 0, false
+		}
+	}
+	return width, height, true
+}
+
+// Parses and validates a crop value, reporting false if it is invalid
+func cropRectangle(value string, width, height int) (int, int, int, int, bool) {
+	options, err := resolveCropSpec(value, width, height)
+	if err != nil {
+		return 0, 0, 0, 0, false
+	}
+
+	x, y, cropWidth, cropHeight, err := parseAndValidateOptions(options, height, width)
+	if err != nil || cropWidth <= 0 || cropHeight <= 0 {
+		return 0, 0, 0, 0, false
+	}
+	return x, y, cropWidth, cropHeight, true
+}
+
+func optionString(step PlanStep) string {
+	if step.Value == "" {
+		return step.Name
+	}
+	return step.Name + "=" + step.Value
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
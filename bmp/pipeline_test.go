@@ -0,0 +1,113 @@
+package bmp
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+// Runs the steps one after another on a copy of the pixels and returns the result with its size
+func runSteps(pixels []Pixel, width, height int, steps []PlanStep) ([]Pixel, int, int, error) {
+	pixels = slices.Clone(pixels)
+	for _, step := range steps {
+		var err error
+		switch {
+		case IsOrientationOption(step.Name):
+			var orientation Orientation
+			orientation, err = ParseOrientation(step.Name, step.Value)
+			if err == nil {
+				pixels, width, height = ApplyOrientation(pixels, width, height, orientation)
+			}
+		case step.Name == "--crop":
+			pixels, width, height, err = ApplyCrop(pixels, width, height, step.Value)
+		case step.Name == "--filter":
+			pixels, err = ApplyFilter(pixels, width, height, step.Value)
+		case step.Name == "--channel":
+			pixels, err = ApplyChannel(pixels, width, height, step.Value)
+		default:
+			err = fmt.Errorf("unexpected step %s", step.Name)
+		}
+		if err != nil {
+			return nil, 0, 0, err
+		}
+	}
+	return pixels, width, height, nil
+}
+
+func TestCompilePlanEquivalence(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []Option
+		steps   int // Number of steps of the optimized plan
+	}{
+		{"four right rotations", []Option{{"--rotate", "right"}, {"--rotate", "right"}, {"--rotate", "right"}, {"--rotate", "right"}}, 0},
+		{"two mirrors", []Option{{"--mirror", "horizontal"}, {"--mirror", "horizontal"}}, 0},
+		{"mirror and rotation", []Option{{"--mirror", "horizontal"}, {"--rotate", "right"}}, 1},
+		{"orientations and transpose", []Option{{"--rotate", "left"}, {"--transpose", ""}, {"--mirror", "vertical"}, {"--transverse", ""}}, 1},
+		{"double negative", []Option{{"--filter", "negative"}, {"--filter", "negative"}}, 0},
+		{"crop after negative", []Option{{"--filter", "negative"}, {"--crop", "1-1-4-3"}}, 2},
+		{"crop after rotation", []Option{{"--rotate", "right"}, {"--crop", "1-2-3-4"}}, 2},
+		{"crop after transverse", []Option{{"--transverse", ""}, {"--crop", "0-1-2-3"}}, 2},
+		{"consecutive crops", []Option{{"--crop", "1-1-5-4"}, {"--crop", "1-0-3-2"}}, 1},
+		{"crop with gravity", []Option{{"--rotate", "180"}, {"--crop", "gravity:northeast:3x2"}}, 2},
+		{"crop with percentages", []Option{{"--mirror", "vertical"}, {"--crop", "20%-20%-60%-60%"}}, 2},
+		{"pointwise filters and crops", []Option{{"--filter", "grayscale"}, {"--rotate", "left"}, {"--filter", "sepia"}, {"--crop", "center:3x3"}, {"--crop", "1-1"}}, 4},
+		{"channel before crop", []Option{{"--channel", "scale:hsv.s,1.5"}, {"--crop", "2-1-3-3"}}, 2},
+		{"blur keeps its place", []Option{{"--filter", "blur:size=3"}, {"--crop", "1-1-3-3"}}, 2},
+	}
+
+	width, height := 7, 5
+	pixels := testImage(width, height)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := CompilePlan(tt.options, width, height)
+			if err != nil {
+				t.Fatalf("CompilePlan failed: %v", err)
+			}
+			if len(plan) != tt.steps {
+				t.Errorf("plan has %d steps, want %d:\n%s", len(plan), tt.steps, ExplainPlan(plan))
+			}
+
+			var unoptimized []PlanStep
+			for _, opt := range tt.options {
+				unoptimized = append(unoptimized, PlanStep{Option: opt})
+			}
+			want, wantWidth, wantHeight, err := runSteps(pixels, width, height, unoptimized)
+			if err != nil {
+				t.Fatalf("running the options failed: %v", err)
+			}
+			got, gotWidth, gotHeight, err := runSteps(pixels, width, height, plan)
+			if err != nil {
+				t.Fatalf("running the plan failed: %v", err)
+			}
+
+			if gotWidth != wantWidth || gotHeight != wantHeight {
+				t.Fatalf("plan gives a %dx%d image, want %dx%d", gotWidth, gotHeight, wantWidth, wantHeight)
+			}
+			if !slices.Equal(got, want) {
+				t.Errorf("plan gives different pixels than the options:\n%s", ExplainPlan(plan))
+			}
+		})
+	}
+}
+
+func TestCompilePlanErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []Option
+	}{
+		{"region before a crop", []Option{{"--region", "0,0,2,2"}, {"--crop", "0-0-2-2"}}},
+		{"region at the end", []Option{{"--filter", "negative"}, {"--region", "0,0,2,2"}}},
+		{"empty region", []Option{{"--region", ""}, {"--filter", "negative"}}},
+		{"region with a filter region", []Option{{"--region", "0,0,2,2"}, {"--filter", "blur:region=0-0-2-2"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := CompilePlan(tt.options, 7, 5); err == nil {
+				t.Errorf("CompilePlan(%v) succeeded, want an error", tt.options)
+			}
+		})
+	}
+}
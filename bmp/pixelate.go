@@ -0,0 +1,116 @@
+package bmp
+
+import (
+	"fmt"
+	"math"
+)
+
+// Pixelates the image with the given style: square blocks, hexagonal cells, dots of the block color
+// on a background or halftone (black dots sized by the darkness of the block on white)
+func applyPixelationStyle(pixels []Pixel, width, height, size int, style string, background Pixel) ([]Pixel, error) {
+	switch style {
+	case "square":
+		return applyPixelation(pixels, width, height, size), nil
+	case "hex":
+		return applyHexPixelation(pixels, width, height, size), nil
+	case "dots", "halftone":
+		return applyDotPixelation(pixels, width, height, size, style == "halftone", background), nil
+	default:
+		return nil, fmt.Errorf("invalid pixelation style - '%s'", style)
+	}
+}
+
+// Averages the colors of pointy-top hexagonal cells whose width is roughly the given size
+func applyHexPixelation(pixels []Pixel, width, height, size int) []Pixel {
+	radius := float64(size) / math.Sqrt(3) // Distance from the cell center to its corners
+
+	// Finds the axial coordinates of the hexagon containing the point
+	cellOf := func(x, y int) [2]int {
+		px, py := float64(x)+0.5, float64(y)+0.5
+		q := (math.Sqrt(3)/3*px - py/3) / radius
+		r := (2.0 / 3 * py) / radius
+
+		// Round cube coordinates (q, r, -q-r) to the nearest hexagon
+		s := -q - r
+		rq, rr, rs := math.Round(q), math.Round(r), math.Round(s)
+		dq, dr, ds := math.Abs(rq-q), math.Abs(rr-r), math.Abs(rs-s)
+		if dq > dr && dq > ds {
+			rq = -rr - rs
+		} else if dr > ds {
+			rr = -rq - rs
+		}
+		return [2]int{int(rq), int(rr)}
+	}
+
+	type sum struct{ r, g, b, count int }
+	cells := map[[2]int]*sum{}
+	indices := make([][2]int, len(pixels))
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			idx := y*width + x
+			cell := cellOf(x, y)
+			indices[idx] = cell
+
+			s, ok := cells[cell]
+			if !ok {
+				s = &sum{}
+				cells[cell] = s
+			}
+			s.r += int(pixels[idx].Red)
+			s.g += int(pixels[idx].Green)
+			s.b += int(pixels[idx].Blue)
+			s.count++
+		}
+	}
+
+	for idx, cell := range indices {
+		s := cells[cell]
+		pixels[idx] = Pixel{Red: uint8(s.r / s.count), Green: uint8(s.g / s.count), Blue: uint8(s.b / s.count)}
+	}
+	return pixels
+}
+
+// Replaces every block with a circle. Dots use the average color of the block at full size,
+// halftone dots are black and their area follows the darkness of the block
+func applyDotPixelation(pixels []Pixel, width, height, size int, halftone bool, background Pixel) []Pixel {
+	if halftone {
+		background = white
+	}
+
+	for y := 0; y < height; y += size {
+		for x := 0; x < width; x += size {
+			var sumR, sumG, sumB, count int
+			for dy := 0; dy < size && (y+dy) < height; dy++ {
+				for dx := 0; dx < size && (x+dx) < width; dx++ {
+					idx := (y+dy)*width + (x + dx)
+					sumR += int(pixels[idx].Red)
+					sumG += int(pixels[idx].Green)
+					sumB += int(pixels[idx].Blue)
+					count++
+				}
+			}
+			average := Pixel{Red: uint8(sumR / count), Green: uint8(sumG / count), Blue: uint8(sumB / count)}
+
+			dot := average
+			radius := float64(size) / 2
+			if halftone {
+				dot = black
+				l, _ := luma(average, "bt601")
+				// Area of the dot matches the darkness, dots touch at full black
+				radius = float64(size) / math.Sqrt(math.Pi) * math.Sqrt(1-l/255)
+			}
+
+			centerX, centerY := float64(x)+float64(size)/2, float64(y)+float64(size)/2
+			for dy := 0; dy < size && (y+dy) < height; dy++ {
+				for dx := 0; dx < size && (x+dx) < width; dx++ {
+					// Anti-aliased edge: coverage falls off over one pixel around the radius
+					distance := math.Hypot(float64(x+dx)+0.5-centerX, float64(y+dy)+0.5-centerY)
+					coverage := clampFloat(radius-distance+0.5, 0, 1)
+					pixels[(y+dy)*width+(x+dx)] = mixPixels(background, dot, coverage)
+				}
+			}
+		}
+	}
+	return pixels
+}
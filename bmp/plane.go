@@ -0,0 +1,101 @@
+package bmp
+
+import "math"
+
+// Extracts the BT.601 luma of every pixel into a single-channel plane (0-255)
+func lumaPlane(pixels []Pixel) []float64 {
+	plane := make([]float64, len(pixels))
+	for i, p := range pixels {
+		plane[i] = 0.299*float64(p.Red) + 0.587*float64(p.Green) + 0.114*float64(p.Blue)
+	}
+	return plane
+}
+
+// Calculates the mean of the (2*radius+1)^2 window around every sample of the plane.
+// Windows are clipped at the image borders
+func boxMeanPlane(plane []float64, width, height, radius int) []float64 {
+	// Summed-area table with an extra zero row and column
+	stride := width + 1
+	integral := make([]float64, stride*(height+1))
+	for y := 0; y < height; y++ {
+		var rowSum float64
+		for x := 0; x < width; x++ {
+			rowSum += plane[y*width+x]
+			integral[(y+1)*stride+x+1] = integral[y*stride+x+1] + rowSum
+		}
+	}
+
+	mean := make([]float64, len(plane))
+	for y := 0; y < height; y++ {
+		top, bottom := max(y-radius, 0), min(y+radius+1, height)
+		for x := 0; x < width; x++ {
+			left, right := max(x-radius, 0), min(x+radius+1, width)
+			sum := integral[bottom*stride+right] - integral[top*stride+right] - integral[bottom*stride+left] + integral[top*stride+left]
+			mean[y*width+x] = sum / float64((bottom-top)*(right-left))
+		}
+	}
+	return mean
+}
+
+// Builds a normalized 1D Gaussian kernel covering three standard deviations
+func gaussianKernel(sigma float64) []float64 {
+	radius := int(math.Ceil(sigma * 3))
+	kernel := make([]float64, 2*radius+1)
+
+	var sum float64
+	for i := range kernel {
+		d := float64(i - radius)
+		kernel[i] = math.Exp(-d * d / (2 * sigma * sigma))
+		sum += kernel[i]
+	}
+	for i := range kernel {
+		kernel[i] /= sum
+	}
+	return kernel
+}
+
+// Blurs the plane with a separable Gaussian kernel, replicating the border samples
+func gaussianBlurPlane(plane []float64, width, height int, sigma float64) []float64 {
+	kernel := gaussianKernel(sigma)
+	radius := len(kernel) / 2
+
+	horizontal := make([]float64, len(plane))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var sum float64
+			for k, weight := range kernel {
+				sum += plane[y*width+clampInt(x+k-radius, 0, width-1)] * weight
+			}
+			horizontal[y*width+x] = sum
+		}
+	}
+
+	blurred := make([]float64, len(plane))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var sum float64
+			for k, weight := range kernel {
+				sum += horizontal[clampInt(y+k-radius, 0, height-1)*width+x] * weight
+			}
+			blurred[y*width+x] = sum
+		}
+	}
+	return blurred
+}
+
+// Calculates the horizontal and vertical Sobel gradients of the plane, replicating the border samples
+func sobelPlane(plane []float64, width, height int) ([]float64, []float64) {
+	gx := make([]float64, len(plane))
+	gy := make([]float64, len(plane))
+
+	at := func(x, y int) float64 {
+		return plane[clampInt(y, 0, height-1)*width+clampInt(x, 0, width-1)]
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			gx[y*width+x] = at(x+1, y-1) + 2*at(x+1, y) + at(x+1, y+1) - at(x-1, y-1) - 2*at(x-1, y) - at(x-1, y+1)
+			gy[y*width+x] = at(x-1, y+1) + 2*at(x, y+1) + at(x+1, y+1) - at(x-1, y-1) - 2*at(x, y-1) - at(x+1, y-1)
+		}
+	}
+	return gx, gy
+}
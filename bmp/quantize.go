@@ -0,0 +1,383 @@
+package bmp
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Represents a distinct color of the image and the number of pixels that have it
+type colorCount struct {
+	color Pixel
+	count int
+}
+
+// Generates a palette of at most the given number of colors that represents the image well.
+// Supported methods are "median-cut", "octree" and "kmeans"
+func Quantize(pixels []Pixel, colors int, method string) ([]Pixel, error) {
+	if colors < 2 || colors > 256 {
+		return nil, fmt.Errorf("number of colors must be between 2 and 256, got %d", colors)
+	}
+
+	histogram := colorHistogram(pixels)
+	if len(histogram) <= colors {
+		// The image already fits into the palette
+		palette := make([]Pixel, len(histogram))
+		for i, c := range histogram {
+			palette[i] = c.color
+		}
+		return palette, nil
+	}
+
+	switch method {
+	case "median-cut":
+		return medianCut(histogram, colors), nil
+	case "octree":
+		return octreeQuantize(histogram, colors), nil
+	case "kmeans":
+		return kMeans(histogram, medianCut(histogram, colors), 16), nil
+	default:
+		return nil, fmt.Errorf("invalid quantization method - '%s'", method)
+	}
+}
+
+// Parses a quantization spec of the form "<colors>[:<method>]"
+func ParseQuantizeValue(value string) (int, string, error) {
+	countValue, method, found := strings.Cut(value, ":")
+	if !found {
+		method = "median-cut"
+	}
+
+	colors, err := strconv.Atoi(countValue)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid number of colors - '%s'", countValue)
+	}
+
+	return colors, method, nil
+}
+
+// Collects the distinct colors of the image with their pixel counts
+func colorHistogram(pixels []Pixel) []colorCount {
+	counts := map[Pixel]int{}
+	for _, p := range pixels {
+		counts[p]++
+	}
+
+	histogram := make([]colorCount, 0, len(counts))
+	for color, count := range counts {
+		histogram = append(histogram, colorCount{color, count})
+	}
+
+	// Map iteration order is random, sort to keep the palette reproducible
+	sort.Slice(histogram, func(i, j int) bool {
+		a, b := histogram[i].color, histogram[j].color
+		return packColor(a) < packColor(b)
+	})
+	return histogram
+}
+
+func packColor(p Pixel) int {
+	return int(p.Red)<<16 | int(p.Green)<<8 | int(p.Blue)
+}
+
+func channel(p Pixel, c int) byte {
+	switch c {
+	case 0:
+		return p.Red
+	case 1:
+		return p.Green
+	default:
+		return p.Blue
+	}
+}
+
+// Returns the pixel-weighted mean color of the histogram entries
+func meanColor(colors []colorCount) Pixel {
+	var sumR, sumG, sumB, total float64
+	for _, c := range colors {
+		weight := float64(c.count)
+		sumR += float64(c.color.Red) * weight
+		sumG += float64(c.color.Green) * weight
+		sumB += float64(c.color.Blue) * weight
+		total += weight
+	}
+	return Pixel{Red: clampByte(sumR / total), Green: clampByte(sumG / total), Blue: clampByte(sumB / total)}
+}
+
+// Recursively splits the box of colors with the widest channel range (weighted by pixel count)
+// at the median of that channel until there are as many boxes as colors
+func medianCut(histogram []colorCount, colors int) []Pixel {
+	type box struct {
+		colors  []colorCount
+		channel int     // Channel with the widest range
+		score   float64 // Priority for splitting
+	}
+
+	measure := func(colors []colorCount) box {
+		b := box{colors: colors}
+		var pixelCount int
+		bestRange := -1
+		for c := 0; c < 3; c++ {
+			low, high := 255, 0
+			for _, entry := range colors {
+				v := int(channel(entry.color, c))
+				low, high = min(low, v), max(high, v)
+			}
+			if high-low > bestRange {
+				bestRange, b.channel = high-low, c
+			}
+		}
+		for _, entry := range colors {
+			pixelCount += entry.count
+		}
+		if len(colors) > 1 {
+			b.score = float64(bestRange) * math.Sqrt(float64(pixelCount))
+		}
+		return b
+	}
+
+	boxes := []box{measure(histogram)}
+	for len(boxes) < colors {
+		// Pick the box that benefits the most from splitting
+		best := 0
+		for i := range boxes {
+			if boxes[i].score > boxes[best].score {
+				best = i
+			}
+		}
+		if boxes[best].score == 0 {
+			break
+		}
+
+		b := boxes[best]
+		sort.Slice(b.colors, func(i, j int) bool {
+			return channel(b.colors[i].color, b.channel) < channel(b.colors[j].color, b.channel)
+		})
+
+		// Split at the weighted median, keeping at least one color on each side
+		var total, running int
+		for _, entry := range b.colors {
+			total += entry.count
+		}
+		split := 1
+		for i, entry := range b.colors[:len(b.colors)-1] {
+			running += entry.count
+			if running*2 >= total {
+				split = i + 1
+				break
+			}
+		}
+
+		boxes[best] = measure(b.colors[:split])
+		boxes = append(boxes, measure(b.colors[split:]))
+	}
+
+	palette := make([]Pixel, len(boxes))
+	for i, b := range boxes {
+		palette[i] = meanColor(b.colors)
+	}
+	return palette
+}
+
+// Represents a node of the color octree. Every level splits the color cube in eight by one bit per channel
+type octreeNode struct {
+	children         [8]*octreeNode
+	leaf             bool
+	count            int
+	sumR, sumG, sumB int
+}
+
+// Builds an octree of all colors and merges the least populated deepest nodes until
+// at most the given number of leaves remain
+func octreeQuantize(histogram []colorCount, colors int) []Pixel {
+	const depth = 8
+	root := &octreeNode{}
+	levels := make([][]*octreeNode, depth) // Inner nodes per level
+	leaves := 0
+
+	for _, entry := range histogram {
+		node := root
+		for level := 0; level < depth; level++ {
+			if node.leaf {
+				break
+			}
+			shift := uint(7 - level)
+			index := int(entry.color.Red>>shift&1)<<2 | int(entry.color.Green>>shift&1)<<1 | int(entry.color.Blue>>shift&1)
+			if node.children[index] == nil {
+				child := &octreeNode{leaf: level == depth-1}
+				node.children[index] = child
+				if child.leaf {
+					leaves++
+				} else {
+					levels[level+1] = append(levels[level+1], child)
+				}
+			}
+			node = node.children[index]
+		}
+		node.count += entry.count
+		node.sumR += int(entry.color.Red) * entry.count
+		node.sumG += int(entry.color.Green) * entry.count
+		node.sumB += int(entry.color.Blue) * entry.count
+	}
+	levels[0] = []*octreeNode{root}
+
+	// Folds the whole subtree of the node into the node and returns the number of leaves it had
+	var fold func(node *octreeNode) int
+	fold = func(node *octreeNode) int {
+		if node.leaf {
+			return 1
+		}
+		folded := 0
+		for i, child := range node.children {
+			if child == nil {
+				continue
+			}
+			folded += fold(child)
+			node.count += child.count
+			node.sumR += child.sumR
+			node.sumG += child.sumG
+			node.sumB += child.sumB
+			node.children[i] = nil
+		}
+		node.leaf = true
+		return folded
+	}
+
+	// Subtree pixel counts decide which nodes are merged first
+	var subtree func(node *octreeNode) (int, int)
+	subtree = func(node *octreeNode) (count int, leafCount int) {
+		if node.leaf {
+			return node.count, 1
+		}
+		for _, child := range node.children {
+			if child != nil {
+				c, l := subtree(child)
+				count, leafCount = count+c, leafCount+l
+			}
+		}
+		return count, leafCount
+	}
+
+	for level := depth - 1; level >= 0 && leaves > colors; level-- {
+		nodes := levels[level]
+		counts := make(map[*octreeNode]int, len(nodes))
+		for _, node := range nodes {
+			counts[node], _ = subtree(node)
+		}
+		sort.SliceStable(nodes, func(i, j int) bool { return counts[nodes[i]] < counts[nodes[j]] })
+
+		for _, node := range nodes {
+			if leaves <= colors {
+				break
+			}
+			// Skip merges that would leave fewer colors than requested
+			if _, leafCount := subtree(node); leaves-(leafCount-1) < colors {
+				continue
+			}
+			leaves -= fold(node) - 1
+		}
+	}
+
+	var clusters []colorCount
+	var sums [][3]int
+	var collect func(node *octreeNode)
+	collect = func(node *octreeNode) {
+		if node.leaf {
+			if node.count > 0 {
+				clusters = append(clusters, colorCount{count: node.count})
+				sums = append(sums, [3]int{node.sumR, node.sumG, node.sumB})
+			}
+			return
+		}
+		for _, child := range node.children {
+			if child != nil {
+				collect(child)
+			}
+		}
+	}
+	collect(root)
+
+	mean := func(i int) [3]float64 {
+		n := float64(clusters[i].count)
+		return [3]float64{float64(sums[i][0]) / n, float64(sums[i][1]) / n, float64(sums[i][2]) / n}
+	}
+
+	// Merges that would have overshot are finished by joining the two closest clusters
+	for len(clusters) > colors {
+		bestI, bestJ, bestDistance := 0, 1, math.MaxFloat64
+		for i := range clusters {
+			for j := i + 1; j < len(clusters); j++ {
+				a, b := mean(i), mean(j)
+				distance := (a[0]-b[0])*(a[0]-b[0]) + (a[1]-b[1])*(a[1]-b[1]) + (a[2]-b[2])*(a[2]-b[2])
+				if distance < bestDistance {
+					bestI, bestJ, bestDistance = i, j, distance
+				}
+			}
+		}
+		clusters[bestI].count += clusters[bestJ].count
+		for c := 0; c < 3; c++ {
+			sums[bestI][c] += sums[bestJ][c]
+		}
+		clusters = append(clusters[:bestJ], clusters[bestJ+1:]...)
+		sums = append(sums[:bestJ], sums[bestJ+1:]...)
+	}
+
+	palette := make([]Pixel, len(clusters))
+	for i := range clusters {
+		m := mean(i)
+		palette[i] = Pixel{Red: clampByte(m[0]), Green: clampByte(m[1]), Blue: clampByte(m[2])}
+	}
+	return palette
+}
+
+// Refines the palette with weighted k-means (Lloyd's algorithm) over the distinct colors
+func kMeans(histogram []colorCount, palette []Pixel, iterations int) []Pixel {
+	centers := make([][3]float64, len(palette))
+	for i, p := range palette {
+		centers[i] = [3]float64{float64(p.Red), float64(p.Green), float64(p.Blue)}
+	}
+
+	for iteration := 0; iteration < iterations; iteration++ {
+		sums := make([][3]float64, len(centers))
+		weights := make([]float64, len(centers))
+
+		for _, entry := range histogram {
+			r, g, b := float64(entry.color.Red), float64(entry.color.Green), float64(entry.color.Blue)
+			best, bestDistance := 0, math.MaxFloat64
+			for i, c := range centers {
+				distance := (r-c[0])*(r-c[0]) + (g-c[1])*(g-c[1]) + (b-c[2])*(b-c[2])
+				if distance < bestDistance {
+					best, bestDistance = i, distance
+				}
+			}
+			weight := float64(entry.count)
+			sums[best][0] += r * weight
+			sums[best][1] += g * weight
+			sums[best][2] += b * weight
+			weights[best] += weight
+		}
+
+		moved := false
+		for i := range centers {
+			if weights[i] == 0 {
+				continue // Keep empty clusters where they are
+			}
+			next := [3]float64{sums[i][0] / weights[i], sums[i][1] / weights[i], sums[i][2] / weights[i]}
+			if math.Abs(next[0]-centers[i][0])+math.Abs(next[1]-centers[i][1])+math.Abs(next[2]-centers[i][2]) > 0.5 {
+				moved = true
+			}
+			centers[i] = next
+		}
+		if !moved {
+			break
+		}
+	}
+
+	result := make([]Pixel, len(centers))
+	for i, c := range centers {
+		result[i] = Pixel{Red: clampByte(c[0]), Green: clampByte(c[1]), Blue: clampByte(c[2])}
+	}
+	return result
+}
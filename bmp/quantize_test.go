@@ -0,0 +1,133 @@
+package bmp
+
+import (
+	"slices"
+	"testing"
+)
+
+// Builds an image of noisy pixels around the given cluster colors
+func clusterImage(centers []Pixel, perCluster int) []Pixel {
+	var pixels []Pixel
+	for _, center := range centers {
+		for i := 0; i < perCluster; i++ {
+			jitter := byte(i % 5)
+			pixels = append(pixels, Pixel{Red: center.Red + jitter, Green: center.Green + jitter/2, Blue: center.Blue + (4 - jitter)})
+		}
+	}
+	return pixels
+}
+
+// Returns the squared RGB distance between two colors
+func squaredDistance(a, b Pixel) int {
+	dr, dg, db := int(a.Red)-int(b.Red), int(a.Green)-int(b.Green), int(a.Blue)-int(b.Blue)
+	return dr*dr + dg*dg + db*db
+}
+
+func TestQuantize(t *testing.T) {
+	centers := []Pixel{{Red: 20, Green: 20, Blue: 20}, {Red: 200, Green: 30, Blue: 40}, {Red: 30, Green: 190, Blue: 60}, {Red: 40, Green: 50, Blue: 210}}
+	pixels := clusterImage(centers, 60)
+
+	tests := []struct {
+		name   string
+		method string
+		colors int
+	}{
+		{"median cut", "median-cut", 4},
+		{"octree", "octree", 4},
+		{"k-means", "kmeans", 4},
+		{"median cut with spare colors", "median-cut", 8},
+		{"octree with spare colors", "octree", 8},
+		{"k-means with spare colors", "kmeans", 8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			palette, err := Quantize(pixels, tt.colors, tt.method)
+			if err != nil {
+				t.Fatalf("Quantize failed: %v", err)
+			}
+			if len(palette) == 0 || len(palette) > tt.colors {
+				t.Fatalf("palette has %d colors, want 1 to %d", len(palette), tt.colors)
+			}
+
+			// Every cluster must be represented by a nearby palette color
+			for _, center := range centers {
+				nearest := palette[nearestColor(center, palette)]
+				if distance := squaredDistance(center, nearest); distance > 3*10*10 {
+					t.Errorf("cluster %v is mapped to %v, squared distance %d", center, nearest, distance)
+				}
+			}
+		})
+	}
+}
+
+func TestQuantizeSmallImage(t *testing.T) {
+	pixels := []Pixel{{Red: 1}, {Green: 2}, {Blue: 3}, {Red: 1}, {Green: 2}}
+
+	for _, method := range []string{"median-cut", "octree", "kmeans"} {
+		t.Run(method, func(t *testing.T) {
+			palette, err := Quantize(pixels, 4, method)
+			if err != nil {
+				t.Fatalf("Quantize failed: %v", err)
+			}
+			want := []Pixel{{Red: 1}, {Green: 2}, {Blue: 3}}
+			if len(palette) != len(want) {
+				t.Fatalf("palette = %v, want the %d colors of the image", palette, len(want))
+			}
+			for _, color := range want {
+				if !slices.Contains(palette, color) {
+					t.Errorf("palette %v does not contain %v", palette, color)
+				}
+			}
+		})
+	}
+}
+
+func TestQuantizeErrors(t *testing.T) {
+	pixels := clusterImage([]Pixel{{}, {Red: 255}, {Green: 255}}, 10)
+
+	tests := []struct {
+		name   string
+		colors int
+		method string
+	}{
+		{"too few colors", 1, "median-cut"},
+		{"too many colors", 257, "median-cut"},
+		{"unknown method", 2, "popularity"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Quantize(pixels, tt.colors, tt.method); err == nil {
+				t.Error("Quantize succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestParseQuantizeValue(t *testing.T) {
+	tests := []struct {
+		value      string
+		wantColors int
+		wantMethod string
+		wantErr    bool
+	}{
+		{"16", 16, "median-cut", false},
+		{"256:octree", 256, "octree", false},
+		{"8:kmeans", 8, "kmeans", false},
+		{"many", 0, "", true},
+		{":octree", 0, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			colors, method, err := ParseQuantizeValue(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseQuantizeValue(%q) error = %v, want error %v", tt.value, err, tt.wantErr)
+			}
+			if colors != tt.wantColors || method != tt.wantMethod {
+				t.Errorf("ParseQuantizeValue(%q) = %d, %q, want %d, %q", tt.value, colors, method, tt.wantColors, tt.wantMethod)
+			}
+		})
+	}
+}
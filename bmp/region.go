@@ -0,0 +1,207 @@
+package bmp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Represents how strongly an effect is applied to every pixel (0 keeps the original, 1 applies it fully)
+type Mask []float64
+
+// Parses a --region value: "<x>,<y>,<width>,<height>" (or "<x>,<y>" for the rest of the image) or
+// "mask=<file.bmp>", optionally followed by ",feather=<px>" to soften the edges of the region
+func ParseRegion(value string, width, height int) (Mask, error) {
+	var rectangle []string
+	var maskFile string
+	feather := 0.0
+
+	for _, part := range strings.Split(value, ",") {
+		key, argument, named := strings.Cut(part, "=")
+		switch {
+		case !named:
+			rectangle = append(rectangle, part)
+		case key == "mask":
+			maskFile = argument
+		case key == "feather":
+			var err error
+			feather, err = strconv.ParseFloat(argument, 64)
+			if err != nil || feather < 0 {
+				return nil, fmt.Errorf("invalid region feather - '%s'", argument)
+			}
+		default:
+			return nil, fmt.Errorf("unknown region parameter - '%s'", key)
+		}
+	}
+
+	var mask Mask
+	var err error
+	switch {
+	case maskFile != "" && len(rectangle) > 0:
+		return nil, fmt.Errorf("region '%s' has both a rectangle and a mask", value)
+	case maskFile != "":
+		mask, err = ReadMask(maskFile, width, height)
+	default:
+		mask, err = ParseRegionMask(strings.Join(rectangle, ","), width, height)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if feather > 0 {
+		mask = Mask(gaussianBlurPlane(mask, width, height, feather/2))
+	}
+	return mask, nil
+}
+
+// Builds a mask that covers the rectangle given as "<offsetX>-<offsetY>-<width>-<height>"
+// (or "<offsetX>-<offsetY>" for the rest of the image), validated like crop options.
+// The values may be separated by commas instead, but not by both
+func ParseRegionMask(value string, width, height int) (Mask, error) {
+	separator := "-"
+	if strings.Contains(value, ",") {
+		separator = ","
+	}
+
+	var options []int
+	for _, part := range strings.Split(value, separator) {
+		num, err := strconv.Atoi(part)
+		if err != nil || num < 0 {
+			return nil, fmt.Errorf("invalid region - '%s'", value)
+		}
+		options = append(options, num)
+	}
+
+	offsetX, offsetY, regionWidth, regionHeight, err := parseAndValidateOptions(options, height, width)
+	if err != nil || regionWidth == 0 || regionHeight == 0 {
+		return nil, fmt.Errorf("invalid region - '%s'", value)
+	}
+
+	mask := make(Mask, width*height)
+	for y := offsetY; y < offsetY+regionHeight; y++ {
+		for x := offsetX; x < offsetX+regionWidth; x++ {
+			mask[y*width+x] = 1
+		}
+	}
+	return mask, nil
+}
+
+// Reads a mask from a BMP file of the same size as the image. White applies the effect fully,
+// black keeps the original and gray levels blend between them
+func ReadMask(filename string, width, height int) (Mask, error) {
+	bmpHeader, dibHeader, err := ReadHeaders(filename)
+	if err != nil {
+		return nil, err
+	}
+	if int(dibHeader.Width) != width || int(dibHeader.Height) != height {
+		return nil, fmt.Errorf("mask %s is %dx%d, expected %dx%d", filename, dibHeader.Width, dibHeader.Height, width, height)
+	}
+
+	pixels, err := ReadPixels(filename, bmpHeader, dibHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	mask := make(Mask, len(pixels))
+	for i, l := range lumaPlane(pixels) {
+		mask[i] = l / 255
+	}
+	return mask, nil
+}
+
+// Builds the mask of a filter from its region and mask parameters, or returns nil if neither is given
+func filterMask(params *filterParams, width, height int) (Mask, error) {
+	region := params.String("region", "")
+	maskFile := params.String("mask", "")
+
+	switch {
+	case region != "" && maskFile != "":
+		return nil, fmt.Errorf("filter '%s' accepts either a region or a mask, not both", params.filter)
+	case region != "":
+		return ParseRegionMask(region, width, height)
+	case maskFile != "":
+		return ReadMask(maskFile, width, height)
+	default:
+		return nil, nil
+	}
+}
+
+// Runs the effect on the bounding box of the mask and blends the result back according to the mask,
+// so the effect neither processes nor sees pixels outside of the region. Positions used by the
+// effect (e.g. block grids and centers) are relative to the box. A nil mask applies the effect to the whole image
+func ApplyMasked[T sample[T]](pixels []T, width, height int, mask Mask, effect func(pixels []T, width, height int) ([]T, error)) ([]T, error) {
+	if mask == nil {
+		return effect(pixels, width, height)
+	}
+
+	left, top, right, bottom := maskBounds(mask, width, height)
+	if left >= right {
+		return pixels, nil // Empty region
+	}
+
+	boxWidth, boxHeight := right-left, bottom-top
+	box := make([]T, 0, boxWidth*boxHeight)
+	for y := top; y < bottom; y++ {
+		box = append(box, pixels[y*width+left:y*width+right]...)
+	}
+
+	processed, err := effect(box, boxWidth, boxHeight)
+	if err != nil {
+		return nil, err
+	}
+	if len(processed) != boxWidth*boxHeight {
+		return nil, fmt.Errorf("effect changed the image size and cannot be limited to a region")
+	}
+
+	blendMasked(pixels, width, mask, processed, left, top, boxWidth, boxHeight)
+	return pixels, nil
+}
+
+// Runs the effect on a copy of the whole image and blends the result back according to the mask.
+// Unlike ApplyMasked the effect keeps the image coordinates, for effects that place content at a
+// position (overlays, watermarks) without mixing neighboring pixels. A nil mask applies the effect to the whole image
+func ApplyMaskedInImage[T sample[T]](pixels []T, width, height int, mask Mask, effect func(pixels []T, width, height int) ([]T, error)) ([]T, error) {
+	if mask == nil {
+		return effect(pixels, width, height)
+	}
+
+	processed, err := effect(append([]T(nil), pixels...), width, height)
+	if err != nil {
+		return nil, err
+	}
+	if len(processed) != width*height {
+		return nil, fmt.Errorf("effect changed the image size and cannot be limited to a region")
+	}
+
+	blendMasked(pixels, width, mask, processed, 0, 0, width, height)
+	return pixels, nil
+}
+
+// Returns the bounding box of the pixels with a positive weight. The box is empty (left >= right)
+// if the mask has none
+func maskBounds(mask Mask, width, height int) (left, top, right, bottom int) {
+	left, top = width, height
+	for i, weight := range mask {
+		if weight > 0 {
+			x, y := i%width, i/width
+			left, top = min(left, x), min(top, y)
+			right, bottom = max(right, x+1), max(bottom, y+1)
+		}
+	}
+	return left, top, right, bottom
+}
+
+// Blends the processed box with its top left corner at (left, top) into the pixels according to the mask
+func blendMasked[T sample[T]](pixels []T, width int, mask Mask, processed []T, left, top, boxWidth, boxHeight int) {
+	for y := 0; y < boxHeight; y++ {
+		for x := 0; x < boxWidth; x++ {
+			idx := (top+y)*width + left + x
+			switch weight := mask[idx]; {
+			case weight >= 1:
+				pixels[idx] = processed[y*boxWidth+x]
+			case weight > 0:
+				pixels[idx] = pixels[idx].mix(processed[y*boxWidth+x], weight)
+			}
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package bmp
+
+import (
+	"slices"
+	"testing"
+)
+
+// Builds a test image in which every pixel has a different color
+func testImage(width, height int) []Pixel {
+	pixels := make([]Pixel, width*height)
+	for i := range pixels {
+		pixels[i] = Pixel{Red: byte(i * 7), Green: byte(255 - i*3), Blue: byte(i * 13 % 256)}
+	}
+	return pixels
+}
+
+// Builds the mask of the rectangle in an image of the given width
+func rectangleMask(width, height, x, y, w, h int) Mask {
+	mask := make(Mask, width*height)
+	for row := y; row < y+h; row++ {
+		for column := x; column < x+w; column++ {
+			mask[row*width+column] = 1
+		}
+	}
+	return mask
+}
+
+func TestParseRegionMask(t *testing.T) {
+	width, height := 10, 8
+
+	tests := []struct {
+		value   string
+		want    Mask
+		wantErr bool
+	}{
+		{value: "1-2-3-4", want: rectangleMask(width, height, 1, 2, 3, 4)},
+		{value: "1,2,3,4", want: rectangleMask(width, height, 1, 2, 3, 4)},
+		{value: "0-0-10-8", want: rectangleMask(width, height, 0, 0, 10, 8)},
+		{value: "6,5", want: rectangleMask(width, height, 6, 5, 4, 3)},
+		{value: "9-7-1-1", want: rectangleMask(width, height, 9, 7, 1, 1)},
+		{value: "-5,0,10,10", wantErr: true},
+		{value: "10--20-30-40", wantErr: true},
+		{value: "1-2,3,4", wantErr: true},
+		{value: "1,,3,4", wantErr: true},
+		{value: "1,2,3,", wantErr: true},
+		{value: "1,2,3", wantErr: true},
+		{value: "1,2,3,4,5", wantErr: true},
+		{value: "1,2,0,4", wantErr: true},
+		{value: "10,0,1,1", wantErr: true},
+		{value: "5,5,6,2", wantErr: true},
+		{value: "a,b,c,d", wantErr: true},
+		{value: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			mask, err := ParseRegionMask(tt.value, width, height)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("ParseRegionMask succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseRegionMask failed: %v", err)
+			}
+			if !slices.Equal(mask, tt.want) {
+				t.Errorf("ParseRegionMask(%q) covers the wrong pixels", tt.value)
+			}
+		})
+	}
+}
+
+func TestParseRegion(t *testing.T) {
+	tests := []struct {
+		value   string
+		wantErr bool
+	}{
+		{value: "1,1,4,4"},
+		{value: "1,1,4,4,feather=2"},
+		{value: "2,3"},
+		{value: "1,1,4,4,feather=-1", wantErr: true},
+		{value: "1,1,4,4,blur=2", wantErr: true},
+		{value: "1,1,4,4,mask=region.bmp", wantErr: true},
+		{value: "mask=missing.bmp", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			_, err := ParseRegion(tt.value, 10, 8)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseRegion(%q) error = %v, want error %v", tt.value, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestApplyMasked(t *testing.T) {
+	width, height := 6, 5
+	negative := func(pixels []Pixel, width, height int) ([]Pixel, error) {
+		return ApplyFilter(pixels, width, height, "negative")
+	}
+	half := make(Mask, width*height)
+	half[7] = 0.5
+
+	tests := []struct {
+		name string
+		mask Mask
+	}{
+		{"whole image", nil},
+		{"rectangle", rectangleMask(width, height, 1, 1, 3, 2)},
+		{"empty region", make(Mask, width*height)},
+		{"partial weight", half},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := testImage(width, height)
+			inverted, _ := negative(slices.Clone(original), width, height)
+
+			got, err := ApplyMasked(slices.Clone(original), width, height, tt.mask, negative)
+			if err != nil {
+				t.Fatalf("ApplyMasked failed: %v", err)
+			}
+
+			for i := range got {
+				weight := 1.0
+				if tt.mask != nil {
+					weight = tt.mask[i]
+				}
+				if want := mixPixels(original[i], inverted[i], weight); got[i] != want {
+					t.Errorf("pixel %d = %v, want %v", i, got[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyMaskedRunsOnTheBox(t *testing.T) {
+	width, height := 12, 9
+	pixels := testImage(width, height)
+	mask := rectangleMask(width, height, 3, 2, 6, 4)
+
+	// Blurring the region must only see the pixels inside of it, like blurring a crop of it
+	blur := func(pixels []Pixel, width, height int) ([]Pixel, error) {
+		return ApplyFilter(pixels, width, height, "blur:size=3")
+	}
+	got, err := ApplyMasked(slices.Clone(pixels), width, height, mask, blur)
+	if err != nil {
+		t.Fatalf("ApplyMasked failed: %v", err)
+	}
+	crop, cropWidth, cropHeight, _ := ApplyCrop(pixels, width, height, "3-2-6-4")
+	want, _ := blur(crop, cropWidth, cropHeight)
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			expected := pixels[y*width+x]
+			if x >= 3 && x < 9 && y >= 2 && y < 6 {
+				expected = want[(y-2)*cropWidth+x-3]
+			}
+			if got[y*width+x] != expected {
+				t.Errorf("pixel %d,%d = %v, want %v", x, y, got[y*width+x], expected)
+			}
+		}
+	}
+}
+
+func TestApplyMaskedInImage(t *testing.T) {
+	width, height := 8, 6
+	pixels := testImage(width, height)
+	mask := rectangleMask(width, height, 4, 2, 3, 3)
+
+	// The effect draws at image coordinates, so only the part of the mark inside of the region shows
+	mark := func(pixels []Pixel, width, height int) ([]Pixel, error) {
+		for y := 1; y < 4; y++ {
+			for x := 2; x < 6; x++ {
+				pixels[y*width+x] = Pixel{Red: 255}
+			}
+		}
+		return pixels, nil
+	}
+	got, err := ApplyMaskedInImage(slices.Clone(pixels), width, height, mask, mark)
+	if err != nil {
+		t.Fatalf("ApplyMaskedInImage failed: %v", err)
+	}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			expected := pixels[y*width+x]
+			if x >= 4 && x < 6 && y >= 2 && y < 4 {
+				expected = Pixel{Red: 255}
+			}
+			if got[y*width+x] != expected {
+				t.Errorf("pixel %d,%d = %v, want %v", x, y, got[y*width+x], expected)
+			}
+		}
+	}
+}
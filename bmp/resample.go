@@ -0,0 +1,150 @@
+package bmp
+
+import (
+	"fmt"
+	"math"
+)
+
+// Computes the color at a fractional position of the image. Pixel centers lie at half-integer
+// coordinates and positions beyond the borders are clamped to the nearest pixel
+type interpolation func(pixels []Pixel, width, height int, x, y float64) [3]float64
+
+// Returns the interpolation with the given name: nearest, bilinear or bicubic
+func parseInterpolation(name string) (interpolation, error) {
+	switch name {
+	case "nearest":
+		return sampleNearest, nil
+	case "bilinear":
+		return sampleBilinear, nil
+	case "bicubic":
+		return sampleBicubic, nil
+	default:
+		return nil, fmt.Errorf("invalid interpolation - '%s'", name)
+	}
+}
+
+// Samples the pixel that contains the position
+func sampleNearest(pixels []Pixel, width, height int, x, y float64) [3]float64 {
+	p := pixels[clampInt(int(math.Floor(y)), 0, height-1)*width+clampInt(int(math.Floor(x)), 0, width-1)]
+	return [3]float64{float64(p.Red), float64(p.Green), float64(p.Blue)}
+}
+
+// Samples the image at a fractional position with bilinear interpolation, clamping at the borders
+func sampleBilinear(pixels []Pixel, width, height int, x, y float64) [3]float64 {
+	x = clampFloat(x-0.5, 0, float64(width-1))
+	y = clampFloat(y-0.5, 0, float64(height-1))
+	x0, y0 := int(x), int(y)
+	x1, y1 := min(x0+1, width-1), min(y0+1, height-1)
+	wx, wy := x-float64(x0), y-float64(y0)
+
+	var result [3]float64
+	corners := [4]Pixel{pixels[y0*width+x0], pixels[y0*width+x1], pixels[y1*width+x0], pixels[y1*width+x1]}
+	weights := [4]float64{(1 - wx) * (1 - wy), wx * (1 - wy), (1 - wx) * wy, wx * wy}
+	for i, p := range corners {
+		result[0] += float64(p.Red) * weights[i]
+		result[1] += float64(p.Green) * weights[i]
+		result[2] += float64(p.Blue) * weights[i]
+	}
+	return result
+}
+
+// Samples the image with a Catmull-Rom bicubic kernel over the 4x4 closest pixels
+func sampleBicubic(pixels []Pixel, width, height int, x, y float64) [3]float64 {
+	x, y = x-0.5, y-0.5
+	x0, y0 := int(math.Floor(x)), int(math.Floor(y))
+	fx, fy := x-float64(x0), y-float64(y0)
+
+	cubic := func(t float64) [4]float64 {
+		return [4]float64{
+			((-t+2)*t - 1) * t / 2,
+			((3*t-5)*t*t + 2) / 2,
+			((-3*t+4)*t + 1) * t / 2,
+			(t - 1) * t * t / 2,
+		}
+	}
+	wx, wy := cubic(fx), cubic(fy)
+
+	var result [3]float64
+	for j := 0; j < 4; j++ {
+		row := clampInt(y0-1+j, 0, height-1) * width
+		for i := 0; i < 4; i++ {
+			p := pixels[row+clampInt(x0-1+i, 0, width-1)]
+			weight := wx[i] * wy[j]
+			result[0] += float64(p.Red) * weight
+			result[1] += float64(p.Green) * weight
+			result[2] += float64(p.Blue) * weight
+		}
+	}
+	return result
+}
+
+// Builds an image of the given size where every pixel is sampled at the source position returned
+// by the inverse mapping of its center. Positions outside of the source get the background color
+func resample(pixels []Pixel, width, height, newWidth, newHeight int, inverse func(x, y float64) (float64, float64), interpolate interpolation, background Pixel) []Pixel {
+	result := make([]Pixel, newWidth*newHeight)
+
+	for y := 0; y < newHeight; y++ {
+		for x := 0; x < newWidth; x++ {
+			sx, sy := inverse(float64(x)+0.5, float64(y)+0.5)
+			if sx < 0 || sy < 0 || sx > float64(width) || sy > float64(height) || math.IsNaN(sx) || math.IsNaN(sy) {
+				result[y*newWidth+x] = background
+				continue
+			}
+
+			c := interpolate(pixels, width, height, sx, sy)
+			result[y*newWidth+x] = Pixel{Red: clampByte(c[0]), Green: clampByte(c[1]), Blue: clampByte(c[2])}
+		}
+	}
+	return result
+}
+
+// Resamples an opacity mask like resample does the pixels. Positions outside of the source are transparent
+func resampleMask(mask Mask, width, height, newWidth, newHeight int, inverse func(x, y float64) (float64, float64), interpolate interpolation) Mask {
+	// The mask is interpolated as a gray image, which keeps the 8-bit precision of the output
+	gray := make([]Pixel, len(mask))
+	for i, weight := range mask {
+		v := clampByte(weight * 255)
+		gray[i] = Pixel{Red: v, Green: v, Blue: v}
+	}
+
+	result := make(Mask, newWidth*newHeight)
+	for i, p := range resample(gray, width, height, newWidth, newHeight, inverse, interpolate, black) {
+		result[i] = float64(p.Red) / 255
+	}
+	return result
+}
+
+// Scales the image to the new size. Shrinking averages all source pixels covered by every new
+// pixel so fine detail does not alias, enlarging interpolates bilinearly
+func resize(pixels []Pixel, width, height, newWidth, newHeight int) []Pixel {
+	if newWidth >= width && newHeight >= height {
+		scaleX, scaleY := float64(width)/float64(newWidth), float64(height)/float64(newHeight)
+		inverse := func(x, y float64) (float64, float64) { return x * scaleX, y * scaleY }
+		return resample(pixels, width, height, newWidth, newHeight, inverse, sampleBilinear, black)
+	}
+
+	result := make([]Pixel, newWidth*newHeight)
+	for y := 0; y < newHeight; y++ {
+		y0, y1 := y*height/newHeight, max((y+1)*height/newHeight, y*height/newHeight+1)
+		for x := 0; x < newWidth; x++ {
+			x0, x1 := x*width/newWidth, max((x+1)*width/newWidth, x*width/newWidth+1)
+
+			var sum [3]int
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					p := pixels[sy*width+sx]
+					sum[0] += int(p.Red)
+					sum[1] += int(p.Green)
+					sum[2] += int(p.Blue)
+				}
+			}
+			count := (y1 - y0) * (x1 - x0)
+			result[y*newWidth+x] = Pixel{
+				Red:   byte((sum[0] + count/2) / count),
+				Green: byte((sum[1] + count/2) / count),
+				Blue:  byte((sum[2] + count/2) / count),
+			}
+		}
+	}
+	return result
+}
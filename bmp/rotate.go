@@ -4,46 +4,15 @@ import (
 	"fmt"
 )
 
-// Applies rotation to the image. Supports rotatiob by 90, 180, and 270 degrees
-func ApplyRotate(pixels []Pixel, width int, height int, angle int) ([]Pixel, int, int, error) {
-	var newWidth, newHeight int
-	var rotatedPixels []Pixel
-
-	switch angle {
-	case 90:
-		newWidth, newHeight = height, width
-		rotatedPixels = make([]Pixel, newWidth*newHeight)
-		for y := 0; y < height; y++ {
-			for x := 0; x < width; x++ {
-				newX := height - y - 1
-				newY := x
-				rotatedPixels[newY*newWidth+newX] = pixels[y*width+x]
-			}
-		}
-	case 180:
-		newWidth, newHeight = width, height
-		rotatedPixels = make([]Pixel, newWidth*newHeight)
-		for y := 0; y < height; y++ {
-			for x := 0; x < width; x++ {
-				newX := width - x - 1
-				newY := height - y - 1
-				rotatedPixels[newY*newWidth+newX] = pixels[y*width+x]
-			}
-		}
-	case 270:
-		newWidth, newHeight = height, width
-		rotatedPixels = make([]Pixel, newWidth*newHeight)
-		for y := 0; y < height; y++ {
-			for x := 0; x < width; x++ {
-				newX := y
-				newY := width - x - 1
-				rotatedPixels[newY*newWidth+newX] = pixels[y*width+x]
-			}
-		}
-	default:
+// Applies rotation to the image (8-bit or linear-light pixels). Supports rotatiob by 90, 180, and 270 degrees
+func ApplyRotate[T any](pixels []T, width int, height int, angle int) ([]T, int, int, error) {
+	orientations := map[int]Orientation{90: OrientRotate90, 180: OrientRotate180, 270: OrientRotate270}
+	orientation, ok := orientations[angle]
+	if !ok {
 		return nil, 0, 0, fmt.Errorf("'%v' is not a valid angle value", angle)
 	}
 
+	rotatedPixels, newWidth, newHeight := ApplyOrientation(pixels, width, height, orientation)
 	return rotatedPixels, newWidth, newHeight, nil
 }
 
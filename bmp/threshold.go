@@ -0,0 +1,108 @@
+package bmp
+
+import (
+	"fmt"
+	"math"
+)
+
+var (
+	black = Pixel{Red: 0, Green: 0, Blue: 0}
+	white = Pixel{Red: 255, Green: 255, Blue: 255}
+)
+
+// Turns pixels with luma above the level white and all others black
+func applyThreshold(pixels []Pixel, level float64) []Pixel {
+	for i, l := range lumaPlane(pixels) {
+		if l > level {
+			pixels[i] = white
+		} else {
+			pixels[i] = black
+		}
+	}
+	return pixels
+}
+
+// Binarizes the image with the threshold that best separates its luma histogram into two classes (Otsu's method)
+func applyOtsu(pixels []Pixel) []Pixel {
+	return applyThreshold(pixels, float64(otsuLevel(pixels)))
+}
+
+// Finds the threshold that maximizes the between-class variance of the luma histogram
+func otsuLevel(pixels []Pixel) int {
+	var histogram [256]int
+	for _, l := range lumaPlane(pixels) {
+		histogram[int(l)]++
+	}
+
+	var totalSum float64
+	for level, count := range histogram {
+		totalSum += float64(level * count)
+	}
+
+	var backgroundCount, backgroundSum, bestVariance float64
+	bestLevel := 0
+	total := float64(len(pixels))
+
+	for level, count := range histogram {
+		backgroundCount += float64(count)
+		if backgroundCount == 0 {
+			continue
+		}
+		foregroundCount := total - backgroundCount
+		if foregroundCount == 0 {
+			break
+		}
+
+		backgroundSum += float64(level * count)
+		backgroundMean := backgroundSum / backgroundCount
+		foregroundMean := (totalSum - backgroundSum) / foregroundCount
+
+		variance := backgroundCount * foregroundCount * (backgroundMean - foregroundMean) * (backgroundMean - foregroundMean)
+		if variance > bestVariance {
+			bestVariance, bestLevel = variance, level
+		}
+	}
+
+	return bestLevel
+}
+
+// Binarizes every pixel against the mean or Gaussian-weighted mean of its neighborhood minus the offset,
+// which copes with uneven lighting in scanned and photographed documents
+func applyAdaptiveThreshold(pixels []Pixel, width, height int, method string, size int, offset float64) ([]Pixel, error) {
+	plane := lumaPlane(pixels)
+
+	var local []float64
+	switch method {
+	case "mean":
+		local = boxMeanPlane(plane, width, height, size/2)
+	case "gaussian":
+		local = gaussianBlurPlane(plane, width, height, float64(size)/6)
+	default:
+		return nil, fmt.Errorf("invalid adaptive threshold method - '%s'", method)
+	}
+
+	for i, l := range plane {
+		if l > local[i]-offset {
+			pixels[i] = white
+		} else {
+			pixels[i] = black
+		}
+	}
+	return pixels, nil
+}
+
+// Reduces every channel to the given number of evenly spaced levels
+func applyPosterize(pixels []Pixel, levels int) []Pixel {
+	var table [256]byte
+	step := 255 / float64(levels-1)
+	for v := range table {
+		table[v] = clampByte(math.Round(float64(v)/step) * step)
+	}
+
+	for i := range pixels {
+		pixels[i].Red = table[pixels[i].Red]
+		pixels[i].Green = table[pixels[i].Green]
+		pixels[i].Blue = table[pixels[i].Blue]
+	}
+	return pixels
+}
@@ -0,0 +1,95 @@
+package bmp
+
+import (
+	"fmt"
+	"math"
+)
+
+// Calculates the gray level of a pixel with the given luma formula
+func luma(p Pixel, method string) (float64, error) {
+	r, g, b := float64(p.Red), float64(p.Green), float64(p.Blue)
+
+	switch method {
+	case "bt601":
+		return 0.299*r + 0.587*g + 0.114*b, nil
+	case "bt709":
+		return 0.2126*r + 0.7152*g + 0.0722*b, nil
+	case "average":
+		return (r + g + b) / 3, nil
+	case "lightness":
+		// Perceptual lightness (CIE L*) mapped back to 0-255
+		return rgbToLab(pixelToRGB(p))[0] / 100 * 255, nil
+	case "desaturate":
+		return (math.Max(r, math.Max(g, b)) + math.Min(r, math.Min(g, b))) / 2, nil
+	case "red":
+		return r, nil
+	case "green":
+		return g, nil
+	case "blue":
+		return b, nil
+	default:
+		return 0, fmt.Errorf("invalid grayscale method - '%s'", method)
+	}
+}
+
+// Converts the image to grayscale with the selected luma formula
+func applyGrayscale(pixels []Pixel, method string) ([]Pixel, error) {
+	if _, err := luma(Pixel{}, method); err != nil {
+		return nil, err
+	}
+
+	for i := range pixels {
+		l, _ := luma(pixels[i], method)
+		gray := uint8(l)
+		pixels[i].Red, pixels[i].Green, pixels[i].Blue = gray, gray, gray
+	}
+	return pixels, nil
+}
+
+// Applies the classic sepia tone matrix, blended with the original by amount (0-1)
+func applySepia(pixels []Pixel, amount float64) []Pixel {
+	for i, p := range pixels {
+		r, g, b := float64(p.Red), float64(p.Green), float64(p.Blue)
+
+		sepiaR := 0.393*r + 0.769*g + 0.189*b
+		sepiaG := 0.349*r + 0.686*g + 0.168*b
+		sepiaB := 0.272*r + 0.534*g + 0.131*b
+
+		pixels[i] = Pixel{
+			Red:   clampByte(r + (sepiaR-r)*amount),
+			Green: clampByte(g + (sepiaG-g)*amount),
+			Blue:  clampByte(b + (sepiaB-b)*amount),
+		}
+	}
+	return pixels
+}
+
+// Maps the luma of every pixel onto a gradient between the shadow and highlight colors
+func applyDuotone(pixels []Pixel, shadow, highlight Pixel) []Pixel {
+	for i, p := range pixels {
+		t, _ := luma(p, "bt601")
+		pixels[i] = mixPixels(shadow, highlight, t/255)
+	}
+	return pixels
+}
+
+// Replaces hue and saturation of every pixel with those of the color, keeping its lightness.
+// The result is blended with the original by amount (0-1)
+func applyColorize(pixels []Pixel, color Pixel, amount float64) []Pixel {
+	hsl := rgbToHSL(pixelToRGB(color))
+	for i, p := range pixels {
+		lightness := rgbToHSL(pixelToRGB(p))[2]
+		tinted := rgbToPixel(hslToRGB([3]float64{hsl[0], hsl[1], lightness}))
+		pixels[i] = mixPixels(p, tinted, amount)
+	}
+	return pixels
+}
+
+// Linearly interpolates between two pixels (t = 0 gives a, t = 1 gives b)
+func mixPixels(a, b Pixel, t float64) Pixel {
+	return Pixel{
+		Red:   clampByte(float64(a.Red) + (float64(b.Red)-float64(a.Red))*t),
+		Green: clampByte(float64(a.Green) + (float64(b.Green)-float64(a.Green))*t),
+		Blue:  clampByte(float64(a.Blue) + (float64(b.Blue)-float64(a.Blue))*t),
+	}
+}
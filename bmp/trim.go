@@ -0,0 +1,70 @@
+package bmp
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Removes uniform borders from the image and its opacity (nil for an opaque image). The value is
+// "[<tolerance>][:<color>]": pixels whose channels all differ by at most the tolerance (0-255,
+// default 0) from the border color count as border, as do fully transparent pixels. Without a
+// color the color of the top left pixel is used
+func ApplyTrim(pixels []Pixel, alpha Mask, width, height int, value string) ([]Pixel, Mask, int, int, error) {
+	toleranceValue, colorValue, _ := strings.Cut(value, ":")
+
+	tolerance := 0
+	if toleranceValue != "" {
+		var err error
+		tolerance, err = strconv.Atoi(toleranceValue)
+		if err != nil || tolerance < 0 || tolerance > 255 {
+			return nil, nil, 0, 0, fmt.Errorf("invalid trim tolerance - '%s'", toleranceValue)
+		}
+	}
+
+	border := pixels[0]
+	if colorValue != "" {
+		var err error
+		border, err = ParseColor(colorValue)
+		if err != nil {
+			return nil, nil, 0, 0, err
+		}
+	}
+
+	isBorder := func(i int) bool {
+		if alpha != nil && alpha[i] <= 0 {
+			return true
+		}
+		p := pixels[i]
+		return absDiff(p.Red, border.Red) <= tolerance && absDiff(p.Green, border.Green) <= tolerance && absDiff(p.Blue, border.Blue) <= tolerance
+	}
+
+	// Bounding box of all pixels that are not border
+	left, top, right, bottom := width, height, -1, -1
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if !isBorder(y*width + x) {
+				left, right = min(left, x), max(right, x)
+				top, bottom = min(top, y), max(bottom, y)
+			}
+		}
+	}
+	if right < 0 {
+		return nil, nil, 0, 0, errors.New("nothing is left after trimming, the image is uniform")
+	}
+
+	rectangle := fmt.Sprintf("%d-%d-%d-%d", left, top, right-left+1, bottom-top+1)
+	if alpha != nil {
+		alpha, _, _, _ = ApplyCrop(alpha, width, height, rectangle)
+	}
+	pixels, width, height, err := ApplyCrop(pixels, width, height, rectangle)
+	return pixels, alpha, width, height, err
+}
+
+func absDiff(a, b byte) int {
+	if a > b {
+		return int(a - b)
+	}
+	return int(b - a)
+}
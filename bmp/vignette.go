@@ -0,0 +1,36 @@
+package bmp
+
+import "math"
+
+// Darkens the image towards its edges. The radius (0-1, relative to the distance from the center
+// to the farthest corner) is where darkening starts, strength (0-1) is how dark the corners get.
+// The center is given as a fraction of the image size
+func applyVignette(pixels []Pixel, width, height int, strength, radius, centerX, centerY float64) []Pixel {
+	cx, cy := centerX*float64(width), centerY*float64(height)
+
+	// Distance to the farthest corner normalizes the falloff
+	farthest := math.Max(
+		math.Max(math.Hypot(cx, cy), math.Hypot(float64(width)-cx, cy)),
+		math.Max(math.Hypot(cx, float64(height)-cy), math.Hypot(float64(width)-cx, float64(height)-cy)),
+	)
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			distance := math.Hypot(float64(x)+0.5-cx, float64(y)+0.5-cy) / farthest
+			if distance <= radius {
+				continue
+			}
+
+			t := clampFloat((distance-radius)/(1-radius), 0, 1)
+			factor := 1 - strength*t*t*(3-2*t) // Smoothstep falloff
+
+			idx := y*width + x
+			pixels[idx] = Pixel{
+				Red:   clampByte(float64(pixels[idx].Red) * factor),
+				Green: clampByte(float64(pixels[idx].Green) * factor),
+				Blue:  clampByte(float64(pixels[idx].Blue) * factor),
+			}
+		}
+	}
+	return pixels
+}
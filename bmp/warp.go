@@ -0,0 +1,188 @@
+package bmp
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Applies a geometric warp to the image and returns it with its new size. Supported transforms are
+// "affine" (a,b,c,d,e,f mapping x,y to a*x+b*y+c, d*x+e*y+f), "shear" (<x-degrees>,<y-degrees>),
+// "perspective" (the four corners of a quadrilateral that is straightened into a rectangle) and
+// "lens" (k1,k2,k3,p1,p2 lens distortion coefficients). All of them accept the interp and background
+// parameters. The opacity of the image (nil if it is opaque) is warped as well, areas outside of the
+// source become transparent
+func ApplyWarp(pixels []Pixel, alpha Mask, width, height int, transform, value string) ([]Pixel, Mask, int, int, error) {
+	var names []string
+	switch transform {
+	case "affine":
+		names = []string{"a", "b", "c", "d", "e", "f", "fit"}
+	case "shear":
+		names = []string{"x", "y", "fit"}
+	case "perspective":
+		names = []string{"x1", "y1", "x2", "y2", "x3", "y3", "x4", "y4", "size"}
+	case "lens":
+		names = []string{"k1", "k2", "k3", "p1", "p2", "reverse"}
+	default:
+		return nil, nil, 0, 0, fmt.Errorf("invalid transform - '%s'", transform)
+	}
+
+	params := parseFilterParams(transform, value, append(names, "interp", "background")...)
+	interpolate, err := parseInterpolation(params.String("interp", "bilinear"))
+	if err != nil {
+		return nil, nil, 0, 0, err
+	}
+	background := params.Color("background", black)
+
+	inverse, newWidth, newHeight, err := warpMapping(params, names, width, height, transform)
+	if err != nil {
+		return nil, nil, 0, 0, err
+	}
+
+	pixels = resample(pixels, width, height, newWidth, newHeight, inverse, interpolate, background)
+	if alpha != nil {
+		alpha = resampleMask(alpha, width, height, newWidth, newHeight, inverse, interpolate)
+	}
+	return pixels, alpha, newWidth, newHeight, nil
+}
+
+// Reads the parameters of the transform and returns its inverse mapping with the size of the result
+func warpMapping(params *filterParams, names []string, width, height int, transform string) (func(x, y float64) (float64, float64), int, int, error) {
+	switch transform {
+	case "affine":
+		params.Require(names[:6]...)
+		var matrix [6]float64
+		for i, name := range names[:6] {
+			matrix[i] = params.Float(name, 0, -1e6, 1e6)
+		}
+		fit := params.Bool("fit", false)
+		if err := params.Err(); err != nil {
+			return nil, 0, 0, err
+		}
+		return affineMapping(width, height, matrix, fit)
+
+	case "shear":
+		params.Require("x")
+		shearX := params.Float("x", 0, -80, 80)
+		shearY := params.Float("y", 0, -80, 80)
+		fit := params.Bool("fit", true)
+		if err := params.Err(); err != nil {
+			return nil, 0, 0, err
+		}
+		matrix := [6]float64{1, math.Tan(shearX * math.Pi / 180), 0, math.Tan(shearY * math.Pi / 180), 1, 0}
+		return affineMapping(width, height, matrix, fit)
+
+	case "lens":
+		params.Require("k1")
+		var coefficients [5]float64
+		for i, name := range names[:5] {
+			coefficients[i] = params.Float(name, 0, -10, 10)
+		}
+		reverse := params.Bool("reverse", false)
+		if err := params.Err(); err != nil {
+			return nil, 0, 0, err
+		}
+		return lensMapping(width, height, coefficients, reverse), width, height, nil
+
+	default:
+		params.Require(names[:8]...)
+		var corners [4][2]float64
+		for i := range corners {
+			corners[i][0] = params.Float(names[i*2], 0, -1e6, 1e6)
+			corners[i][1] = params.Float(names[i*2+1], 0, -1e6, 1e6)
+		}
+		size := params.String("size", "")
+		if err := params.Err(); err != nil {
+			return nil, 0, 0, err
+		}
+		return perspectiveMapping(width, height, corners, size)
+	}
+}
+
+// Returns the inverse mapping of the affine matrix (a, b, c, d, e, f) and the size of the result.
+// The result keeps the size of the image unless fit is set, in which case the canvas grows or
+// shrinks to the transformed image
+func affineMapping(width, height int, matrix [6]float64, fit bool) (func(x, y float64) (float64, float64), int, int, error) {
+	a, b, c, d, e, f := matrix[0], matrix[1], matrix[2], matrix[3], matrix[4], matrix[5]
+	determinant := a*e - b*d
+	if math.Abs(determinant) < 1e-9 {
+		return nil, 0, 0, fmt.Errorf("affine matrix %v cannot be inverted", matrix)
+	}
+
+	newWidth, newHeight := width, height
+	var offsetX, offsetY float64
+	if fit {
+		minX, minY, maxX, maxY := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+		for _, corner := range [4][2]float64{{0, 0}, {float64(width), 0}, {0, float64(height)}, {float64(width), float64(height)}} {
+			x := a*corner[0] + b*corner[1] + c
+			y := d*corner[0] + e*corner[1] + f
+			minX, minY, maxX, maxY = math.Min(minX, x), math.Min(minY, y), math.Max(maxX, x), math.Max(maxY, y)
+		}
+		offsetX, offsetY = minX, minY
+		newWidth, newHeight = int(math.Ceil(maxX-minX-1e-6)), int(math.Ceil(maxY-minY-1e-6))
+	}
+	if newWidth < 1 || newHeight < 1 || newWidth*newHeight > 1<<28 {
+		return nil, 0, 0, fmt.Errorf("transformed image size %dx%d is not supported", newWidth, newHeight)
+	}
+
+	inverse := func(x, y float64) (float64, float64) {
+		x, y = x+offsetX-c, y+offsetY-f
+		return (e*x - b*y) / determinant, (a*y - d*x) / determinant
+	}
+	return inverse, newWidth, newHeight, nil
+}
+
+// Returns the mapping of the quadrilateral with the corners top-left, top-right, bottom-right and
+// bottom-left onto a rectangle of the given size ("<width>x<height>"), and the size. Without a size
+// the rectangle gets the longer of the opposite edge lengths
+func perspectiveMapping(width, height int, corners [4][2]float64, size string) (func(x, y float64) (float64, float64), int, int, error) {
+	edge := func(i, j int) float64 {
+		return math.Hypot(corners[i][0]-corners[j][0], corners[i][1]-corners[j][1])
+	}
+
+	var newWidth, newHeight int
+	if size == "" {
+		newWidth = int(math.Round(math.Max(edge(0, 1), edge(3, 2))))
+		newHeight = int(math.Round(math.Max(edge(0, 3), edge(1, 2))))
+	} else {
+		widthValue, heightValue, found := strings.Cut(size, "x")
+		var errWidth, errHeight error
+		newWidth, errWidth = strconv.Atoi(widthValue)
+		newHeight, errHeight = strconv.Atoi(heightValue)
+		if !found || errWidth != nil || errHeight != nil {
+			return nil, 0, 0, fmt.Errorf("invalid perspective size - '%s'", size)
+		}
+	}
+	if newWidth < 1 || newHeight < 1 || newWidth*newHeight > 1<<28 {
+		return nil, 0, 0, fmt.Errorf("perspective output size %dx%d is not supported", newWidth, newHeight)
+	}
+
+	// Projective mapping of the unit square onto the quadrilateral (Heckbert)
+	x0, y0 := corners[0][0], corners[0][1]
+	x1, y1 := corners[1][0], corners[1][1]
+	x2, y2 := corners[2][0], corners[2][1]
+	x3, y3 := corners[3][0], corners[3][1]
+
+	sx, sy := x0-x1+x2-x3, y0-y1+y2-y3
+	var g, h float64
+	if sx != 0 || sy != 0 {
+		dx1, dy1 := x1-x2, y1-y2
+		dx2, dy2 := x3-x2, y3-y2
+		determinant := dx1*dy2 - dx2*dy1
+		if math.Abs(determinant) < 1e-9 {
+			return nil, 0, 0, fmt.Errorf("perspective corners must form a quadrilateral")
+		}
+		g = (sx*dy2 - dx2*sy) / determinant
+		h = (dx1*sy - sx*dy1) / determinant
+	}
+	a, b, c := x1-x0+g*x1, x3-x0+h*x3, x0
+	d, e, f := y1-y0+g*y1, y3-y0+h*y3, y0
+
+	inverse := func(x, y float64) (float64, float64) {
+		u, v := x/float64(newWidth), y/float64(newHeight)
+		w := g*u + h*v + 1
+		return (a*u + b*v + c) / w, (d*u + e*v + f) / w
+	}
+	return inverse, newWidth, newHeight, nil
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
 
 	"git.platform.alem.school/amibragim/bitmap/bmp"
 	"git.platform.alem.school/amibragim/bitmap/utils"
@@ -14,66 +16,159 @@ func main() {
 		os.Exit(1)
 	}
 
-	if len(os.Args) == 3 && os.Args[1] == "header" && (os.Args[2] == "-h" || os.Args[2] == "--help") {
-		utils.DisplayHeaderHelp()
-		os.Exit(0)
+	if len(os.Args) == 3 && (os.Args[2] == "-h" || os.Args[2] == "--help") {
+		switch os.Args[1] {
+		case "header":
+			utils.DisplayHeaderHelp()
+			os.Exit(0)
+		case "apply":
+			utils.DisplayApplyHelp()
+			os.Exit(0)
+		case "compose":
+			utils.DisplayComposeHelp()
+			os.Exit(0)
+		case "montage":
+			utils.DisplayMontageHelp()
+			os.Exit(0)
+		case "hald":
+			utils.DisplayHaldHelp()
+			os.Exit(0)
+		case "cube":
+			utils.DisplayCubeHelp()
+			os.Exit(0)
+		}
 	}
 
-	if len(os.Args) == 3 && os.Args[1] == "apply" && (os.Args[2] == "-h" || os.Args[2] == "--help") {
-		utils.DisplayApplyHelp()
-		os.Exit(0)
+	// The montage command takes any number of source files, so its arguments are parsed separately
+	if os.Args[1] == "montage" {
+		sourceFilenames, outputFilename, orderedOptions, err := bmp.ParseMontageArgs(os.Args[2:])
+		utils.HandleError(err)
+
+		pixels, width, height, err := bmp.Montage(sourceFilenames, orderedOptions)
+		utils.HandleError(err)
+
+		bmpHeader, dibHeader := bmp.NewHeaders(width, height)
+		err = bmp.WritePixels(outputFilename, bmpHeader, dibHeader, pixels)
+		utils.HandleError(err)
+		return
 	}
 
 	command, filename, outputFilename, orderedOptions, err := bmp.ParseArgs(os.Args[1:])
 	utils.HandleError(err)
 
-	bmpHeader, dibHeader, err := bmp.ReadHeaders(filename)
-	utils.HandleError(err)
-
-	var croppedWidth, croppedHeight int
-
 	switch command {
 	case "header":
+		bmpHeader, dibHeader, err := bmp.ReadHeaders(filename)
+		utils.HandleError(err)
+
 		bmp.PrintHeader(bmpHeader, dibHeader)
 
 	case "apply":
+		bmpHeader, dibHeader, err := bmp.ReadHeaders(filename)
+		utils.HandleError(err)
+
+		pixels, err := bmp.ReadPixels(filename, bmpHeader, dibHeader)
+		utils.HandleError(err)
+
+		// Compile the options into an optimized plan of processing steps
+		plan, err := bmp.CompilePlan(orderedOptions, int(dibHeader.Width), int(dibHeader.Height))
+		utils.HandleError(err)
+		if bmp.HasFlag(orderedOptions, "--explain") {
+			fmt.Print(bmp.ExplainPlan(plan))
+		}
+
+		var alpha bmp.Mask
+		if bmp.HasFlag(orderedOptions, "--linear") {
+			// Process options in the linear-light working buffer, converting into it and out of it once
+			pixels, alpha = processLinear(pixels, dibHeader, plan)
+		} else {
+			pixels, alpha = processOptions(pixels, dibHeader, plan)
+		}
+
+		err = bmp.WriteOutput(outputFilename, bmpHeader, dibHeader, pixels, alpha, orderedOptions)
+		utils.HandleError(err)
+
+	case "compose":
+		bmpHeader, dibHeader, err := bmp.ReadHeaders(filename)
+		utils.HandleError(err)
+
 		pixels, err := bmp.ReadPixels(filename, bmpHeader, dibHeader)
 		utils.HandleError(err)
 
-		// Process options sequentially
+		layerFilename, mode, anchor, opacity := "", "normal", "center", 1.0
 		for _, opt := range orderedOptions {
 			switch opt.Name {
-			case "--mirror":
-				pixels, err = bmp.ApplyMirror(pixels, int(dibHeader.Width), int(dibHeader.Height), opt.Value)
+			case "--layer":
+				layerFilename = opt.Value
+			case "--mode":
+				mode = opt.Value
+			case "--anchor":
+				anchor = opt.Value
+			case "--opacity":
+				opacity, err = strconv.ParseFloat(opt.Value, 64)
+				if err != nil {
+					utils.HandleError(fmt.Errorf("invalid opacity - '%s'", opt.Value))
+				}
+			case "--bits", "--quantize":
+				continue // Output settings, handled when writing the file
+			default:
+				utils.HandleError(fmt.Errorf("undefined option - %s", opt.Name))
+			}
+		}
+		if layerFilename == "" {
+			utils.HandleError(fmt.Errorf("compose requires the --layer option"))
+		}
 
-			case "--filter":
-				pixels, err = bmp.ApplyFilter(pixels, int(dibHeader.Width), int(dibHeader.Height), opt.Value)
+		layer, layerAlpha, layerDIBHeader, err := bmp.ReadImage(layerFilename)
+		utils.HandleError(err)
 
-			case "--rotate":
-				angle, err := bmp.ParseRotationValue(opt.Value)
-				utils.HandleError(err)
+		pixels, err = bmp.ApplyBlend(pixels, int(dibHeader.Width), int(dibHeader.Height), layer, layerAlpha, int(layerDIBHeader.Width), int(layerDIBHeader.Height), mode, opacity, anchor)
+		utils.HandleError(err)
 
-				var newWidth, newHeight int
-				pixels, newWidth, newHeight, err = bmp.ApplyRotate(pixels, int(dibHeader.Width), int(dibHeader.Height), angle)
+		err = bmp.WriteOutput(outputFilename, bmpHeader, dibHeader, pixels, nil, orderedOptions)
+		utils.HandleError(err)
 
-				// Update image properties after rotating
-				dibHeader.Width = int32(newWidth)
-				dibHeader.Height = int32(newHeight)
+	case "hald":
+		level := 8
+		for _, opt := range orderedOptions {
+			switch opt.Name {
+			case "--level":
+				level, err = strconv.Atoi(opt.Value)
+				if err != nil {
+					utils.HandleError(fmt.Errorf("invalid HALD level - '%s'", opt.Value))
+				}
+			default:
+				utils.HandleError(fmt.Errorf("undefined option - %s", opt.Name))
+			}
+		}
 
-			case "--crop":
-				pixels, croppedWidth, croppedHeight, err = bmp.ApplyCrop(pixels, int(dibHeader.Width), int(dibHeader.Height), opt.Value)
+		pixels, side, err := bmp.GenerateHald(level)
+		utils.HandleError(err)
+
+		bmpHeader, dibHeader := bmp.NewHeaders(side, side)
+		err = bmp.WritePixels(outputFilename, bmpHeader, dibHeader, pixels)
+		utils.HandleError(err)
+
+	case "cube":
+		bmpHeader, dibHeader, err := bmp.ReadHeaders(filename)
+		utils.HandleError(err)
+
+		pixels, err := bmp.ReadPixels(filename, bmpHeader, dibHeader)
+		utils.HandleError(err)
 
-				// Update image properties after cropping
-				dibHeader.Width = int32(croppedWidth)
-				dibHeader.Height = int32(croppedHeight)
-				dibHeader.ImageSize = uint32(croppedWidth * croppedHeight * 3)
+		lut, err := bmp.HaldToLUT(pixels, int(dibHeader.Width), int(dibHeader.Height))
+		utils.HandleError(err)
+
+		for _, opt := range orderedOptions {
+			switch opt.Name {
+			case "--title":
+				lut.Title = opt.Value
 			default:
 				utils.HandleError(fmt.Errorf("undefined option - %s", opt.Name))
 			}
-			utils.HandleError(err)
 		}
 
-		err = bmp.WritePixels(outputFilename, bmpHeader, dibHeader, pixels)
+		err = bmp.WriteCube(outputFilename, lut)
 		utils.HandleError(err)
 
 	default:
@@ -81,3 +176,209 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// Runs the steps of the plan on the pixels. Returns the opacity of the pixels if a step made
+// them transparent, nil otherwise
+func processOptions(pixels []bmp.Pixel, dibHeader *bmp.DIBHeader, plan []bmp.PlanStep) ([]bmp.Pixel, bmp.Mask) {
+	var alpha bmp.Mask
+
+	// Process steps sequentially
+	for _, step := range plan {
+		pixels, alpha = processStep(pixels, alpha, dibHeader, step)
+	}
+
+	return pixels, alpha
+}
+
+// Runs a single step of the plan on the pixels and their opacity (nil while the image is opaque)
+func processStep(pixels []bmp.Pixel, alpha bmp.Mask, dibHeader *bmp.DIBHeader, step bmp.PlanStep) ([]bmp.Pixel, bmp.Mask) {
+	var err error
+	var croppedWidth, croppedHeight int
+
+	// A --region limits the step to a part of the image
+	var region bmp.Mask
+	if step.Region != "" {
+		region, err = bmp.ParseRegion(step.Region, int(dibHeader.Width), int(dibHeader.Height))
+		utils.HandleError(err)
+	}
+
+	switch step.Name {
+	case "--orient":
+		var orientation bmp.Orientation
+		orientation, err = bmp.ParseOrientation(step.Name, step.Value)
+		utils.HandleError(err)
+
+		var newWidth, newHeight int
+		if alpha != nil {
+			alpha, _, _ = bmp.ApplyOrientation(alpha, int(dibHeader.Width), int(dibHeader.Height), orientation)
+		}
+		pixels, newWidth, newHeight = bmp.ApplyOrientation(pixels, int(dibHeader.Width), int(dibHeader.Height), orientation)
+
+		// Update image properties after rotating or mirroring
+		dibHeader.SetDimensions(newWidth, newHeight)
+
+	case "--filter":
+		pixels, err = bmp.ApplyMasked(pixels, int(dibHeader.Width), int(dibHeader.Height), region, func(pixels []bmp.Pixel, width, height int) ([]bmp.Pixel, error) {
+			return bmp.ApplyFilter(pixels, width, height, step.Value)
+		})
+
+	case "--channel":
+		pixels, err = bmp.ApplyMasked(pixels, int(dibHeader.Width), int(dibHeader.Height), region, func(pixels []bmp.Pixel, width, height int) ([]bmp.Pixel, error) {
+			return bmp.ApplyChannel(pixels, width, height, step.Value)
+		})
+
+	case "--lut":
+		var lut *bmp.LUT
+		var interpolation string
+		lut, interpolation, err = bmp.LoadLUT(step.Value)
+		utils.HandleError(err)
+
+		pixels, err = bmp.ApplyMasked(pixels, int(dibHeader.Width), int(dibHeader.Height), region, func(pixels []bmp.Pixel, width, height int) ([]bmp.Pixel, error) {
+			return bmp.ApplyLUT(pixels, width, height, lut, interpolation), nil
+		})
+
+	case "--overlay":
+		pixels, err = bmp.ApplyMaskedInImage(pixels, int(dibHeader.Width), int(dibHeader.Height), region, func(pixels []bmp.Pixel, width, height int) ([]bmp.Pixel, error) {
+			return bmp.ApplyOverlay(pixels, width, height, step.Value)
+		})
+
+	case "--watermark":
+		pixels, err = bmp.ApplyMaskedInImage(pixels, int(dibHeader.Width), int(dibHeader.Height), region, func(pixels []bmp.Pixel, width, height int) ([]bmp.Pixel, error) {
+			return bmp.ApplyWatermark(pixels, width, height, step.Value)
+		})
+
+	case "--chroma":
+		var keyAlpha bmp.Mask
+		pixels, keyAlpha, err = bmp.ApplyChromaKey(pixels, int(dibHeader.Width), int(dibHeader.Height), step.Value)
+		utils.HandleError(err)
+		alpha = bmp.MultiplyAlpha(alpha, keyAlpha)
+
+	case "--mask":
+		var maskAlpha bmp.Mask
+		maskAlpha, err = bmp.ReadMask(step.Value, int(dibHeader.Width), int(dibHeader.Height))
+		utils.HandleError(err)
+		alpha = bmp.MultiplyAlpha(alpha, maskAlpha)
+
+	case "--crop":
+		if alpha != nil {
+			alpha, _, _, err = bmp.ApplyCrop(alpha, int(dibHeader.Width), int(dibHeader.Height), step.Value)
+			utils.HandleError(err)
+		}
+		pixels, croppedWidth, croppedHeight, err = bmp.ApplyCrop(pixels, int(dibHeader.Width), int(dibHeader.Height), step.Value)
+
+		// Update image properties after cropping
+		dibHeader.SetDimensions(croppedWidth, croppedHeight)
+
+	case "--trim":
+		var newWidth, newHeight int
+		pixels, alpha, newWidth, newHeight, err = bmp.ApplyTrim(pixels, alpha, int(dibHeader.Width), int(dibHeader.Height), step.Value)
+		utils.HandleError(err)
+
+		// Update image properties after trimming
+		dibHeader.SetDimensions(newWidth, newHeight)
+
+	case "--pad":
+		var newWidth, newHeight int
+		pixels, alpha, newWidth, newHeight, err = bmp.ApplyPad(pixels, alpha, int(dibHeader.Width), int(dibHeader.Height), step.Value)
+		utils.HandleError(err)
+
+		// Update image properties after padding
+		dibHeader.SetDimensions(newWidth, newHeight)
+
+	case "--extend":
+		var newWidth, newHeight int
+		pixels, alpha, newWidth, newHeight, err = bmp.ApplyExtend(pixels, alpha, int(dibHeader.Width), int(dibHeader.Height), step.Value)
+		utils.HandleError(err)
+
+		// Update image properties after extending the canvas
+		dibHeader.SetDimensions(newWidth, newHeight)
+
+	case "--carve":
+		var newWidth, newHeight int
+		pixels, alpha, newWidth, newHeight, err = bmp.ApplyCarve(pixels, alpha, int(dibHeader.Width), int(dibHeader.Height), step.Value)
+		utils.HandleError(err)
+
+		// Update image properties after seam carving
+		dibHeader.SetDimensions(newWidth, newHeight)
+
+	case "--affine", "--shear", "--perspective", "--lens":
+		var newWidth, newHeight int
+		transform := strings.TrimPrefix(step.Name, "--")
+		pixels, alpha, newWidth, newHeight, err = bmp.ApplyWarp(pixels, alpha, int(dibHeader.Width), int(dibHeader.Height), transform, step.Value)
+		utils.HandleError(err)
+
+		// Update image properties after warping
+		dibHeader.SetDimensions(newWidth, newHeight)
+
+	default:
+		utils.HandleError(fmt.Errorf("undefined option - %s", step.Name))
+	}
+	utils.HandleError(err)
+
+	return pixels, alpha
+}
+
+// Runs the steps of the plan with a high-precision linear-light buffer instead of 8-bit sRGB pixels.
+// The image is converted into the buffer once and out of it once, so every step has to run there
+func processLinear(pixels []bmp.Pixel, dibHeader *bmp.DIBHeader, plan []bmp.PlanStep) ([]bmp.Pixel, bmp.Mask) {
+	var alpha bmp.Mask
+	linearPixels := bmp.ToLinear(pixels)
+
+	for _, step := range plan {
+		var err error
+		width, height := int(dibHeader.Width), int(dibHeader.Height)
+
+		// A --region limits the step to a part of the image
+		var region bmp.Mask
+		if step.Region != "" {
+			region, err = bmp.ParseRegion(step.Region, width, height)
+			utils.HandleError(err)
+		}
+
+		switch step.Name {
+		case "--orient":
+			var orientation bmp.Orientation
+			orientation, err = bmp.ParseOrientation(step.Name, step.Value)
+			utils.HandleError(err)
+
+			if alpha != nil {
+				alpha, _, _ = bmp.ApplyOrientation(alpha, width, height, orientation)
+			}
+			linearPixels, width, height = bmp.ApplyOrientation(linearPixels, width, height, orientation)
+
+			// Update image properties after rotating or mirroring
+			dibHeader.SetDimensions(width, height)
+
+		case "--filter":
+			if !bmp.IsLinearFilter(step.Value) {
+				utils.HandleError(fmt.Errorf("filter '%s' is not supported with --linear", step.Value))
+			}
+			linearPixels, err = bmp.ApplyMasked(linearPixels, width, height, region, func(pixels []bmp.LinearPixel, width, height int) ([]bmp.LinearPixel, error) {
+				return bmp.ApplyFilterLinear(pixels, width, height, step.Value)
+			})
+
+		case "--mask":
+			var maskAlpha bmp.Mask
+			maskAlpha, err = bmp.ReadMask(step.Value, width, height)
+			utils.HandleError(err)
+			alpha = bmp.MultiplyAlpha(alpha, maskAlpha)
+
+		case "--crop":
+			if alpha != nil {
+				alpha, _, _, err = bmp.ApplyCrop(alpha, width, height, step.Value)
+				utils.HandleError(err)
+			}
+			linearPixels, width, height, err = bmp.ApplyCrop(linearPixels, width, height, step.Value)
+			utils.HandleError(err)
+
+			// Update image properties after cropping
+			dibHeader.SetDimensions(width, height)
+
+		default:
+			utils.HandleError(fmt.Errorf("option %s is not supported with --linear", step.Name))
+		}
+		utils.HandleError(err)
+	}
+
+	return bmp.FromLinear(linearPixels), alpha
+}
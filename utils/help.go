@@ -10,6 +10,10 @@ func DisplayGeneralHelp() {
 	fmt.Println("The commands are:")
 	fmt.Println("  header    prints bitmap file header information")
 	fmt.Println("  apply     applies processing to the image and saves it to the file")
+	fmt.Println("  compose   blends a second image onto the image with a blend mode")
+	fmt.Println("  montage   lays out many images in a grid on a single contact sheet")
+	fmt.Println("  hald      generates an identity HALD image for color grading")
+	fmt.Println("  cube      converts a graded HALD image to a .cube LUT file")
 }
 
 // Displays usage instructions for header command
@@ -29,10 +33,144 @@ func DisplayApplyHelp() {
 	fmt.Println("The options are:")
 	fmt.Println("  -h, --help                                                      prints program usage information")
 	fmt.Println("  --mirror=<horizontal|vertical>                                  mirrors the image along the specified axis")
-	fmt.Println("  --filter=<blue|red|green|grayscale|negative|pixelate|blur>      applies a specified filter to the image")
+	fmt.Println("  --filter=<filter>[:<params>]                                    applies a specified filter to the image (see filters below)")
 	fmt.Println("  --rotate=<right|left|90|-90|180|-180|270|-270>                  rotates the image by the specified angle")
+	fmt.Println("  --transpose                                                     mirrors the image along its main diagonal")
+	fmt.Println("  --transverse                                                    mirrors the image along its anti-diagonal")
+	fmt.Println("  --orient=<1-8>                                                  turns an image with the given EXIF orientation upright")
 	fmt.Println("  --crop=<offsetX-offsetY-width-height>                           crops the image based on the specified offset and dimensions")
+	fmt.Println("  --crop=center:<W>x<H>, --crop=gravity:<gravity>:<W>x<H>        crops a window anchored at the center or a side or corner")
+	fmt.Println("  --trim[=<tolerance>[:<color>]]                                  removes uniform borders")
+	fmt.Println("  --pad=<top>,<right>,<bottom>,<left>[:<fill>]                    adds borders around the image")
+	fmt.Println("  --extend=<W>x<H>[:<gravity>[:<fill>]]                           grows the canvas, placing the image by gravity")
+	fmt.Println("  --carve=<W>x<H>[,protect=<file>,remove=<file>]                  resizes the image by removing or inserting seams")
+	fmt.Println("  --affine=<a,b,c,d,e,f>[,fit=<true|false>,interp=<...>,background=<color>]")
+	fmt.Println("                                                                  maps x,y to a*x+b*y+c, d*x+e*y+f")
+	fmt.Println("  --shear=<x-degrees>[,<y-degrees>,fit=<true|false>,interp=<...>,background=<color>]")
+	fmt.Println("                                                                  shears the image horizontally and vertically")
+	fmt.Println("  --perspective=<x1,y1,x2,y2,x3,y3,x4,y4>[,size=<WxH>,interp=<...>,background=<color>]")
+	fmt.Println("                                                                  straightens a quadrilateral into a rectangle")
+	fmt.Println("  --lens=<k1>[,<k2>,<k3>,<p1>,<p2>,reverse=<true|false>,interp=<...>,background=<color>]")
+	fmt.Println("                                                                  corrects Brown-Conrady lens distortion")
+	fmt.Println("  --channel=<extract|swap|scale|shift>:<channels/values>          edits channels in rgb, linear, hsv, hsl, lab or ycbcr space")
+	fmt.Println("  --lut=<file.cube>[:trilinear|tetrahedral]                       applies a 1D or 3D .cube color lookup table")
+	fmt.Println("  --overlay=<file.bmp>[:<x>,<y>[:<opacity>[:<key>[,<tolerance>]]]]")
+	fmt.Println("                                                                  draws another image on top of this one")
+	fmt.Println("  --watermark=<file.bmp>[:gravity=<gravity>,opacity=<0-1>,margin=<px>,tile=<true|false>,key=<color>,tolerance=<n>]")
+	fmt.Println("                                                                  stamps a watermark at a corner, side or center, or tiled")
+	fmt.Println("  --chroma=[<key>][,tolerance=<0-255>,softness=<0-255>,spill=<0-1>]")
+	fmt.Println("                                                                  makes the key color (default green) transparent")
+	fmt.Println("  --mask=<file.bmp>                                               makes the image transparent where the grayscale mask is black")
+	fmt.Println("  --region=<x,y,w,h|mask=<file>>[,feather=<px>]                   limits the next --filter, --channel, --lut, --overlay or")
+	fmt.Println("                                                                  --watermark to a region")
+	fmt.Println("  --bits=<1|4|8|24|32>                                            sets the bit depth of the output file (default 24, 32 with transparency)")
+	fmt.Println("  --quantize=<colors>[:median-cut|octree|kmeans]                  writes an indexed file with an optimal palette of up to 256 colors")
+	fmt.Println("  --explain                                                       prints the optimized processing plan before running it")
+	fmt.Println("  --linear                                                        processes the image in a high-precision linear-light buffer")
+	fmt.Println()
+	fmt.Println("Interpolations for warps are nearest, bilinear (default) and bicubic.")
+	fmt.Println("Fills for new canvas area are a color (default black), edge, mirror or wrap.")
+	fmt.Println()
+	fmt.Println("The filters are:")
+	fmt.Println("  blue, red, green                                                retains only the specified channel")
+	fmt.Println("  negative                                                        inverts the colors of the image")
+	fmt.Println("  pixelate[:size=<n>,style=<square|hex|dots|halftone>,background=<color>,region=<x-y-w-h>,mask=<file>]")
+	fmt.Println("                                                                  pixelates the image or only a region of it")
+	fmt.Println("  blur[:size=<n>,region=<x-y-w-h>,mask=<file>]                   blurs the image or only a region of it")
+	fmt.Println("  motion-blur[:angle=<degrees>,length=<px>,region=<x-y-w-h>,mask=<file>]")
+	fmt.Println("                                                                  smears the image along a direction")
+	fmt.Println("  radial-blur[:angle=<degrees>,cx=<0-1>,cy=<0-1>,region=<x-y-w-h>,mask=<file>]")
+	fmt.Println("                                                                  spins the image around a center")
+	fmt.Println("  zoom-blur[:amount=<0-1>,cx=<0-1>,cy=<0-1>,region=<x-y-w-h>,mask=<file>]")
+	fmt.Println("                                                                  smears the image towards a center")
+	fmt.Println("  grayscale[:bt601|bt709|average|lightness|desaturate|red|green|blue]")
+	fmt.Println("                                                                  converts the image to grayscale with the selected luma formula")
+	fmt.Println("  sepia[:amount=<0-1>]                                            applies a sepia tone")
+	fmt.Println("  duotone:<shadow>,<highlight>                                    maps luma onto a gradient between two colors")
+	fmt.Println("  colorize:<color>[,amount=<0-1>]                                 tints the image with the hue and saturation of a color")
+	fmt.Println("  threshold[:<0-255>]                                             turns pixels above the luma level white and the rest black")
+	fmt.Println("  otsu                                                            thresholds at the automatically chosen (Otsu) level")
+	fmt.Println("  adaptive[:<mean|gaussian>,size=<n>,offset=<c>]                  thresholds against the local neighborhood mean")
+	fmt.Println("  posterize[:<2-256>]                                             reduces every channel to the given number of levels")
+	fmt.Println("  equalize[:luma|channels]                                        equalizes the histogram of the luma or of every channel")
+	fmt.Println("  clahe[:tiles=<n|CxR>,clip=<limit>,mode=<luma|channels>]         applies contrast limited adaptive histogram equalization")
+	fmt.Println("  morph:<op>[,shape=<square|cross|disk>,size=<odd>,kernel=<rows>]")
+	fmt.Println("                                                                  applies erode, dilate, open, close, tophat, blackhat or gradient")
+	fmt.Println("  vignette[:strength=<0-1>,radius=<0-1>,cx=<0-1>,cy=<0-1>]        darkens the image towards its edges")
+	fmt.Println("  noise[:type=<gaussian|uniform|salt-pepper>,amount=<n>,mono=<true|false>,seed=<n>]")
+	fmt.Println("                                                                  adds reproducible random noise")
+	fmt.Println("  grain[:amount=<0-1>,size=<px>,seed=<n>]                         simulates film grain")
+	fmt.Println("  oil[:radius=<n>,levels=<n>]                                     paints the image with flat brush strokes")
+	fmt.Println("  kuwahara[:radius=<n>]                                           smooths flat areas while keeping edges sharp")
+	fmt.Println("  emboss[:angle=<degrees>,strength=<n>,gray=<true|false>]         renders the image as a lit relief")
+	fmt.Println("  cartoon[:levels=<n>,edges=<threshold>,smooth=<sigma>]           posterizes the image and outlines its edges")
+	fmt.Println("  dither[:<method>,bits=<1-7>,palette=<c1-c2-...>,serpentine=<true|false>]")
+	fmt.Println("                                                                  reduces colors with dithering (floyd-steinberg, jarvis, stucki,")
+	fmt.Println("                                                                  atkinson, sierra, sierra-lite, bayer2, bayer4, bayer8, blue-noise)")
+	fmt.Println()
+	fmt.Println("  Filter parameters are positional or named (key=value), colors are names or hex (ff8000)")
 	fmt.Println()
 	fmt.Println("Note:")
 	fmt.Println("  Multiple options can be combined and applied sequentially")
 }
+
+// Displays usage instructions for compose command
+func DisplayComposeHelp() {
+	fmt.Println("Usage:")
+	fmt.Println("  bitmap compose --layer=<layer_file> [options] <source_file> <output_file>")
+	fmt.Println()
+	fmt.Println("The options are:")
+	fmt.Println("  -h, --help                  prints program usage information")
+	fmt.Println("  --layer=<file.bmp>          image blended onto the source (required)")
+	fmt.Println("  --mode=<mode>               blend mode (default normal)")
+	fmt.Println("  --opacity=<0-1>             strength of the blended layer (default 1)")
+	fmt.Println("  --anchor=<gravity>          placement of a layer of a different size (default center)")
+	fmt.Println("  --bits, --quantize          output settings as for apply")
+	fmt.Println()
+	fmt.Println("The blend modes are:")
+	fmt.Println("  normal, multiply, screen, overlay, darken, lighten, difference, exclusion,")
+	fmt.Println("  color-dodge, color-burn, hard-light, soft-light, add, subtract")
+	fmt.Println()
+	fmt.Println("The anchors are:")
+	fmt.Println("  northwest, north, northeast, west, center, east, southwest, south, southeast")
+}
+
+// Displays usage instructions for montage command
+func DisplayMontageHelp() {
+	fmt.Println("Usage:")
+	fmt.Println("  bitmap montage [options] <source_file>... <output_file>")
+	fmt.Println()
+	fmt.Println("The options are:")
+	fmt.Println("  -h, --help                  prints program usage information")
+	fmt.Println("  --tile=<W>x<H>              box every image is scaled to fit into (default 160x120)")
+	fmt.Println("  --columns=<n>               number of columns (default a nearly square grid)")
+	fmt.Println("  --spacing=<px>              gap between and around the tiles (default 10)")
+	fmt.Println("  --background=<color>        color of the sheet, a name or hex (default white)")
+	fmt.Println("  --captions                  writes the file name under every tile")
+}
+
+// Displays usage instructions for hald command
+func DisplayHaldHelp() {
+	fmt.Println("Usage:")
+	fmt.Println("  bitmap hald [options] <output_file>")
+	fmt.Println()
+	fmt.Println("The options are:")
+	fmt.Println("  -h, --help          prints program usage information")
+	fmt.Println("  --level=<2-16>      HALD level, the image is level^3 pixels wide (default 8)")
+	fmt.Println()
+	fmt.Println("Description:")
+	fmt.Println("  Generates an identity HALD image. Grade it in any editor and convert it back with the cube command")
+}
+
+// Displays usage instructions for cube command
+func DisplayCubeHelp() {
+	fmt.Println("Usage:")
+	fmt.Println("  bitmap cube [options] <hald_file> <output_file>")
+	fmt.Println()
+	fmt.Println("The options are:")
+	fmt.Println("  -h, --help          prints program usage information")
+	fmt.Println("  --title=<title>     title stored in the .cube file")
+	fmt.Println()
+	fmt.Println("Description:")
+	fmt.Println("  Converts a graded HALD image to a 3D .cube LUT file")
+}